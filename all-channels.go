@@ -0,0 +1,164 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"text/template"
+
+	"github.com/bpowers/fuse"
+	"github.com/bpowers/fuse/fs"
+	"github.com/bpowers/slack"
+	"golang.org/x/net/context"
+)
+
+// number of messages shown in channels/all/$name/preview
+const previewCount = 20
+
+// AllChannels is channels/all/, which has an entry for every public
+// channel on the team, whether or not we are a member.  Entries are
+// named by channel name, and hold the channel's metadata, a preview
+// of its recent history and a ctl file.  Writing 'join' to ctl moves
+// the channel into channels/by-name and channels/by-id.
+type AllChannels struct {
+	mu   sync.Mutex
+	dn   *DirNode
+	conn *FSConn
+}
+
+func NewAllChannels(conn *FSConn, chans []Room) (*AllChannels, error) {
+	var err error
+	all := new(AllChannels)
+	all.conn = conn
+	all.dn, err = NewDirNode(conn.channels.ds.dn, "all", conn)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode(all): %s", err)
+	}
+
+	for _, room := range chans {
+		c := room.(*Channel)
+		if c.all, err = NewAllChannelDir(all.dn, c); err != nil {
+			return nil, fmt.Errorf("NewAllChannelDir(%s): %s", c.Id(), err)
+		}
+		c.all.Activate()
+	}
+
+	all.dn.Activate()
+	return all, nil
+}
+
+// Add creates an entry for a channel created after we connected.
+func (all *AllChannels) Add(c *Channel) {
+	all.mu.Lock()
+	defer all.mu.Unlock()
+
+	dir, err := NewAllChannelDir(all.dn, c)
+	if err != nil {
+		log.Printf("NewAllChannelDir(%s): %s", c.Id(), err)
+		return
+	}
+	c.all = dir
+	dir.Activate()
+}
+
+// Rename moves a channel's entry after the channel is renamed.
+func (all *AllChannels) Rename(c *Channel, oldName string) {
+	all.mu.Lock()
+	defer all.mu.Unlock()
+
+	if c.Name() == oldName {
+		return
+	}
+	all.dn.removeChild(oldName)
+	dir, err := NewAllChannelDir(all.dn, c)
+	if err != nil {
+		log.Printf("NewAllChannelDir(%s): %s", c.Id(), err)
+		return
+	}
+	c.all = dir
+	dir.Activate()
+}
+
+var allChannelAttrs = []AttrFactory{
+	newPreview,
+	newRoomCtl,
+}
+
+func NewAllChannelDir(parent *DirNode, c *Channel) (*DirNode, error) {
+	dir, err := NewDirNode(parent, c.Name(), c)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode: %s", err)
+	}
+
+	for _, attrFactory := range allChannelAttrs {
+		n, err := attrFactory(dir)
+		if err != nil {
+			return nil, fmt.Errorf("attrFactory: %s", err)
+		}
+		n.Activate()
+	}
+	if err = newMetaDir(dir, c, c.conn); err != nil {
+		return nil, fmt.Errorf("newMetaDir: %s", err)
+	}
+
+	return dir, nil
+}
+
+// previewNode is the most recent history of a channel we may not be
+// in.  It is fetched each time it is opened.
+type previewNode struct {
+	AttrNode
+}
+
+func newPreview(parent *DirNode) (INode, error) {
+	name := "preview"
+	n := new(previewNode)
+	if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+		return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+	}
+	n.mode = 0444
+	return n, nil
+}
+
+func (n *previewNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	// we don't know our size until we've fetched history
+	resp.Flags |= fuse.OpenDirectIO
+	return n, nil
+}
+
+func (n *previewNode) ReadAll(ctx context.Context) ([]byte, error) {
+	c := n.parent.priv.(*Channel)
+	if c.conn.api == nil {
+		return nil, fuse.ENOSYS
+	}
+
+	h, err := c.conn.api.GetChannelHistory(c.Id(), slack.HistoryParameters{
+		Count: previewCount,
+	})
+	if err != nil {
+		return nil, apiErrno("GetChannelHistory", err)
+	}
+	sortMsgs(h.Messages)
+
+	var buf bytes.Buffer
+	t := template.Must(template.New("msg").Funcs(msgFuncs(c.conn)).Parse(c.conn.templates().Msg))
+	for i := range h.Messages {
+		if err := t.Execute(&buf, &h.Messages[i]); err != nil {
+			log.Printf("Execute(%#v): %s", h.Messages[i], err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (n *previewNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"log"
+)
+
+// avatarNode is a user's profile image at one size.  Its name is
+// base plus the extension of the image's URL, as Slack serves both
+// PNGs and JPEGs.
+type avatarNode struct {
+	*remoteNode
+	base string
+	size string
+}
+
+// newAvatar returns a factory for a user's profile image at the
+// given size ("24", "32", ... or "original").
+func newAvatar(base, size string) AttrFactory {
+	return func(parent *DirNode) (INode, error) {
+		u := parent.priv.(*User)
+		url := func() string {
+			return u.imageURL(size)
+		}
+		cachePath := func(url string) string {
+			return u.conn.cacheFile("avatars", u.Id+"-"+size, url, urlExt(url, ".png"))
+		}
+		name := base + urlExt(url(), ".png")
+		n, err := newRemoteNode(parent, name, url, cachePath)
+		if err != nil {
+			return nil, err
+		}
+		return &avatarNode{n, base, size}, nil
+	}
+}
+
+// Update replaces us with a newly named avatar if the user's new
+// image has a different extension.
+func (a *avatarNode) Update() {
+	u := a.parent.priv.(*User)
+	name := a.base + urlExt(u.imageURL(a.size), ".png")
+	if name == a.Name() {
+		return
+	}
+	n, err := newAvatar(a.base, a.size)(a.parent)
+	if err != nil {
+		log.Printf("newAvatar(%s/%s): %s", u.Id, name, err)
+		return
+	}
+	a.parent.removeChild(a.Name())
+	n.Activate()
+}
+
+func (a *avatarNode) Activate() error {
+	if a.parent == nil {
+		return nil
+	}
+
+	return a.parent.addChild(a)
+}
+
+// imageURL returns the profile image URL for the given size.
+func (u *User) imageURL(size string) string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	switch size {
+	case "24":
+		return u.Profile.Image24
+	case "32":
+		return u.Profile.Image32
+	case "48":
+		return u.Profile.Image48
+	case "72":
+		return u.Profile.Image72
+	case "192":
+		return u.Profile.Image192
+	}
+	return u.Profile.ImageOriginal
+}
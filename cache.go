@@ -0,0 +1,241 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bpowers/slack"
+)
+
+// DefaultCacheDir returns $XDG_CACHE_HOME/slackfs, falling back to
+// ~/.cache/slackfs.
+func DefaultCacheDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "slackfs")
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".cache", "slackfs")
+	}
+	return ""
+}
+
+// MsgCache is the on-disk history of a single room.  It is an
+// append-only file of JSON-encoded messages, one per line.  Edits are
+// recorded by appending the updated message, and deletions by
+// appending a message_deleted record, so the last entry for a given
+// timestamp wins.  Once the file grows past maxCacheSize it is
+// compacted, keeping only the newest entry for each of the most
+// recent messages.
+type MsgCache struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File // opened lazily for appending
+	size int64    // of the file, once f is open
+}
+
+const (
+	// maxCacheSize is the size at which a room's cache is
+	// compacted down to (at most) compactedCacheSize bytes.
+	maxCacheSize       = 16 << 20
+	compactedCacheSize = 4 << 20
+)
+
+func OpenMsgCache(dir, teamId, roomId string) (*MsgCache, error) {
+	teamDir := filepath.Join(dir, teamId)
+	if err := os.MkdirAll(teamDir, 0700); err != nil {
+		return nil, fmt.Errorf("MkdirAll(%s): %s", teamDir, err)
+	}
+
+	c := new(MsgCache)
+	c.path = filepath.Join(teamDir, roomId+".log")
+	return c, nil
+}
+
+// Load returns the cached messages, oldest first.  If tail is
+// positive, only the last tail bytes of the cache are read, rather
+// than the room's entire history.
+func (c *MsgCache) Load(tail int64) ([]slack.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.load(tail)
+}
+
+// must be called with c.mu held
+func (c *MsgCache) load(tail int64) ([]slack.Message, error) {
+	f, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Open(%s): %s", c.path, err)
+	}
+	defer f.Close()
+
+	partial := false
+	if tail > 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("Stat(%s): %s", c.path, err)
+		}
+		if fi.Size() > tail {
+			// start on the byte before the tail, so that
+			// the (possibly empty) line it ends can be
+			// skipped without losing a whole message.
+			if _, err = f.Seek(fi.Size()-tail-1, os.SEEK_SET); err != nil {
+				return nil, fmt.Errorf("Seek(%s): %s", c.path, err)
+			}
+			partial = true
+		}
+	}
+
+	byTs := make(map[Timestamp]slack.Message)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if partial {
+			partial = false
+			continue
+		}
+		var msg slack.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			// most likely a partial line written as we
+			// crashed; skip it rather than losing the
+			// whole cache.
+			log.Printf("cache %s: Unmarshal: %s", c.path, err)
+			continue
+		}
+		if msg.SubType == "message_deleted" {
+			if ts, err := ParseTimestamp(msg.DeletedTimestamp); err == nil {
+				delete(byTs, ts)
+			}
+			continue
+		}
+		ts, err := ParseTimestamp(msg.Timestamp)
+		if err != nil {
+			log.Printf("cache %s: %s", c.path, err)
+			continue
+		}
+		byTs[ts] = msg
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Scan(%s): %s", c.path, err)
+	}
+
+	msgs := make([]slack.Message, 0, len(byTs))
+	for _, msg := range byTs {
+		msgs = append(msgs, msg)
+	}
+	sortMsgs(msgs)
+
+	return msgs, nil
+}
+
+// Append records msg at the end of the cache.
+func (c *MsgCache) Append(msg *slack.Message) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("Marshal: %s", err)
+	}
+	buf = append(buf, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil {
+		c.f, err = os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("OpenFile(%s): %s", c.path, err)
+		}
+		fi, err := c.f.Stat()
+		if err != nil {
+			return fmt.Errorf("Stat(%s): %s", c.path, err)
+		}
+		c.size = fi.Size()
+	}
+	if _, err = c.f.Write(buf); err != nil {
+		return fmt.Errorf("Write(%s): %s", c.path, err)
+	}
+	c.size += int64(len(buf))
+
+	if c.size > maxCacheSize {
+		if err = c.compact(); err != nil {
+			return fmt.Errorf("compact: %s", err)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the cache with the newest entry for each message
+// in its last compactedCacheSize bytes, dropping older history,
+// superseded edits and deletion records.
+//
+// must be called with c.mu held
+func (c *MsgCache) compact() error {
+	msgs, err := c.load(compactedCacheSize)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := c.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("OpenFile(%s): %s", tmpPath, err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range msgs {
+		if err = enc.Encode(&msgs[i]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("write %s: %s", tmpPath, err)
+	}
+	if err = os.Rename(tmpPath, c.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Rename(%s): %s", tmpPath, err)
+	}
+
+	// the next Append reopens the new file.
+	c.f.Close()
+	c.f = nil
+	return nil
+}
+
+// Close closes the file we append to.  A later Append reopens it.
+func (c *MsgCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil {
+		return nil
+	}
+	err := c.f.Close()
+	c.f = nil
+	return err
+}
+
+// AppendDeleted records that the message with timestamp ts was
+// deleted.
+func (c *MsgCache) AppendDeleted(ts string) error {
+	var msg slack.Message
+	msg.SubType = "message_deleted"
+	msg.DeletedTimestamp = ts
+	return c.Append(&msg)
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bpowers/slack"
+)
+
+func newTestCache(t *testing.T) (*MsgCache, func()) {
+	dir, err := ioutil.TempDir("", "slackfs-cache-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	c, err := OpenMsgCache(dir, "T1", "C1")
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("OpenMsgCache: %s", err)
+	}
+	return c, func() {
+		c.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func appendTestMsg(t *testing.T, c *MsgCache, ts, text string) {
+	var msg slack.Message
+	msg.Timestamp = ts
+	msg.Text = text
+	if err := c.Append(&msg); err != nil {
+		t.Fatalf("Append(%s): %s", ts, err)
+	}
+}
+
+func msgTexts(msgs []slack.Message) string {
+	texts := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		texts = append(texts, msg.Text)
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestMsgCacheLoad(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	for i, text := range []string{"a", "b", "c", "d", "e"} {
+		appendTestMsg(t, c, fmt.Sprintf("1.%06d", i+1), text)
+	}
+	appendTestMsg(t, c, "1.000002", "b2")
+	if err := c.AppendDeleted("1.000003"); err != nil {
+		t.Fatalf("AppendDeleted: %s", err)
+	}
+
+	msgs, err := c.Load(0)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if got, want := msgTexts(msgs), "a b2 d e"; got != want {
+		t.Fatalf("Load(0) = %q, want %q", got, want)
+	}
+}
+
+func TestMsgCacheLoadTail(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	for i, text := range []string{"a", "b", "c", "d", "e"} {
+		appendTestMsg(t, c, fmt.Sprintf("1.%06d", i+1), text)
+	}
+	c.Close()
+
+	buf, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	lines := bytes.SplitAfter(buf, []byte("\n"))
+	// the last two lines, and the whole file
+	lastTwo := int64(len(lines[3]) + len(lines[4]))
+	size := int64(len(buf))
+
+	for _, tc := range []struct {
+		name string
+		tail int64
+		want string
+	}{
+		{"all", 0, "a b c d e"},
+		{"larger than file", size + 10, "a b c d e"},
+		{"whole file", size, "a b c d e"},
+		{"line boundary", lastTwo, "d e"},
+		// starting partway through "c"'s line, which is
+		// skipped rather than parsed.
+		{"partial first line", lastTwo + 3, "d e"},
+		{"one byte of a line", lastTwo + 1, "d e"},
+	} {
+		msgs, err := c.Load(tc.tail)
+		if err != nil {
+			t.Fatalf("%s: Load(%d): %s", tc.name, tc.tail, err)
+		}
+		if got := msgTexts(msgs); got != tc.want {
+			t.Errorf("%s: Load(%d) = %q, want %q", tc.name, tc.tail, got, tc.want)
+		}
+	}
+}
+
+func TestMsgCacheCompact(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	for i, text := range []string{"a", "b", "c", "d"} {
+		appendTestMsg(t, c, fmt.Sprintf("1.%06d", i+1), text)
+	}
+	appendTestMsg(t, c, "1.000001", "a2")
+	appendTestMsg(t, c, "1.000001", "a3")
+	if err := c.AppendDeleted("1.000002"); err != nil {
+		t.Fatalf("AppendDeleted: %s", err)
+	}
+
+	c.mu.Lock()
+	err := c.compact()
+	c.mu.Unlock()
+	if err != nil {
+		t.Fatalf("compact: %s", err)
+	}
+
+	// superseded edits and deletion records are gone.
+	buf, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if n := bytes.Count(buf, []byte("\n")); n != 3 {
+		t.Fatalf("compacted cache has %d lines, want 3:\n%s", n, buf)
+	}
+	if _, err := os.Stat(c.path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind: %v", err)
+	}
+
+	// and appending carries on with the new file.
+	appendTestMsg(t, c, "1.000005", "e")
+	msgs, err := c.Load(0)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if got, want := msgTexts(msgs), "a3 c d e"; got != want {
+		t.Fatalf("Load(0) = %q, want %q", got, want)
+	}
+}
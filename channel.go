@@ -6,13 +6,22 @@ package slackfs
 
 import (
 	"fmt"
+	"sync"
 
+	"github.com/bpowers/fuse"
 	"github.com/bpowers/slack"
 )
 
 type Channel struct {
 	slack.Channel
 	Session
+
+	// protects the mutable metadata (topic, purpose, ...)
+	// in the embedded slack.Channel
+	metaMu sync.Mutex
+
+	members *MemberDir
+	all     *DirNode // our entry in channels/all
 }
 
 func NewChannel(sc slack.Channel, conn *FSConn) *Channel {
@@ -23,6 +32,19 @@ func NewChannel(sc slack.Channel, conn *FSConn) *Channel {
 	return c
 }
 
+// createChannel creates a new public channel, which we are
+// automatically a member of.
+func (conn *FSConn) createChannel(name string) (Room, error) {
+	sc, err := conn.api.CreateChannel(name)
+	if err != nil {
+		return nil, apiErrno("CreateChannel", err)
+	}
+	sc.IsMember = true
+	c := NewChannel(*sc, conn)
+	conn.all.Add(c)
+	return c, nil
+}
+
 func (c *Channel) BaseChannel() *slack.BaseChannel {
 	return &c.Channel.BaseChannel
 }
@@ -32,15 +54,142 @@ func (c *Channel) Id() string {
 }
 
 func (c *Channel) Name() string {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+
 	return c.Channel.Name
 }
 
 func (c *Channel) IsOpen() bool {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+
 	return c.Channel.IsMember
 }
 
+func (c *Channel) setOpen(open bool) {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+
+	c.Channel.IsMember = open
+}
+
+func (c *Channel) Meta() RoomMeta {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+
+	n := len(c.Members)
+	if n == 0 {
+		n = c.NumMembers
+	}
+	return RoomMeta{
+		Id:          c.Channel.Id,
+		Name:        c.Channel.Name,
+		Topic:       c.Topic.Value,
+		Purpose:     c.Purpose.Value,
+		Creator:     c.Creator,
+		Created:     c.Created.Time(),
+		IsArchived:  c.IsArchived,
+		IsGeneral:   c.IsGeneral,
+		MemberCount: n,
+	}
+}
+
+func (c *Channel) Event(evt slack.SlackEvent) bool {
+	changed := applyMemberChange(evt, c.Id(), &c.metaMu, &c.Channel.Members, c.members)
+	if msg, ok := evt.Data.(*slack.MessageEvent); ok && msg.ChannelId == c.Id() {
+		c.metaMu.Lock()
+		changed = applyMetaMsg((*slack.Message)(msg), &c.Channel.Name,
+			&c.Topic.Value, &c.Purpose.Value, &c.IsArchived) || changed
+		c.metaMu.Unlock()
+	}
+	if changed && c.dir != nil {
+		c.dir.UpdateChildren()
+	}
+	if changed && c.all != nil {
+		c.all.UpdateChildren()
+	}
+	switch evt.Data.(type) {
+	case *slack.MemberJoinedChannelEvent, *slack.MemberLeftChannelEvent:
+		return changed
+	}
+	return c.Session.Event(evt)
+}
+
+func (c *Channel) Ctl(cmd, arg string) error {
+	api := c.conn.api
+	if api == nil {
+		// offline
+		return fuse.ENOSYS
+	}
+	switch cmd {
+	case "join":
+		if _, err := api.JoinChannel(c.Name()); err != nil {
+			return apiErrno("JoinChannel", err)
+		}
+		c.setOpen(true)
+		return c.conn.channels.Show(c)
+	case "leave":
+		if _, err := api.LeaveChannel(c.Id()); err != nil {
+			return apiErrno("LeaveChannel", err)
+		}
+		c.setOpen(false)
+		return c.conn.channels.Hide(c.Id())
+	case "topic":
+		topic, err := api.SetChannelTopic(c.Id(), arg)
+		if err != nil {
+			return apiErrno("SetChannelTopic", err)
+		}
+		c.metaMu.Lock()
+		c.Topic.Value = topic
+		c.metaMu.Unlock()
+		c.dir.UpdateChildren()
+		return nil
+	case "purpose":
+		purpose, err := api.SetChannelPurpose(c.Id(), arg)
+		if err != nil {
+			return apiErrno("SetChannelPurpose", err)
+		}
+		c.metaMu.Lock()
+		c.Purpose.Value = purpose
+		c.metaMu.Unlock()
+		c.dir.UpdateChildren()
+		return nil
+	case "invite":
+		u, err := c.conn.ctlUser(arg)
+		if err != nil {
+			return err
+		}
+		if _, err = api.InviteUserToChannel(c.Id(), u.Id); err != nil {
+			return apiErrno("InviteUserToChannel", err)
+		}
+		return nil
+	case "kick":
+		u, err := c.conn.ctlUser(arg)
+		if err != nil {
+			return err
+		}
+		if err = api.KickUserFromChannel(c.Id(), u.Id); err != nil {
+			return apiErrno("KickUserFromChannel", err)
+		}
+		return nil
+	case "archive":
+		if err := api.ArchiveChannel(c.Id()); err != nil {
+			return apiErrno("ArchiveChannel", err)
+		}
+		c.metaMu.Lock()
+		c.IsArchived = true
+		c.Channel.IsMember = false
+		c.metaMu.Unlock()
+		return c.conn.channels.Hide(c.Id())
+	}
+	// public channels can't be closed, only left.
+	return errBadCtl
+}
+
 func NewChannelDir(parent *DirNode, id string, priv interface{}) (*DirNode, error) {
-	if _, ok := priv.(*Channel); !ok {
+	c, ok := priv.(*Channel)
+	if !ok {
 		return nil, fmt.Errorf("NewChannelDir called w non-chan: %#v", priv)
 	}
 
@@ -56,6 +205,16 @@ func NewChannelDir(parent *DirNode, id string, priv interface{}) (*DirNode, erro
 		}
 		n.Activate()
 	}
+	if err = newMetaDir(dir, c, c.conn); err != nil {
+		return nil, fmt.Errorf("newMetaDir: %s", err)
+	}
+	c.metaMu.Lock()
+	ids := append([]string(nil), c.Channel.Members...)
+	c.metaMu.Unlock()
+	if c.members, err = NewMemberDir(dir, c.conn, ids); err != nil {
+		return nil, fmt.Errorf("NewMemberDir: %s", err)
+	}
+	c.dir = dir
 
 	return dir, nil
 }
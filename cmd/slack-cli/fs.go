@@ -5,14 +5,11 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
-	"os/user"
 	"syscall"
 
 	"github.com/bpowers/fuse"
@@ -20,71 +17,70 @@ import (
 	"github.com/bpowers/slackfs"
 )
 
-const noTokenFound = `No token file could be read.  If you haven't generated one yet, go to
+const noTokenFound = `No token could be read.  If you haven't generated one yet, go to
 https://api.slack.com/web and scroll to the bottom. If 'none' is
 listed as the token, then click the green 'Create Token' button next
 to it. Copy the token that appears in red into an otherwise empty file
 stored at ~/.slack-token (or a location of your choosing, specified in
 the environment by SLACKFS_TOKEN_PATH or after the commandline flag
--token-path).
+-token-path), and 'chmod 600' it.  Alternatively, store it in a
+password manager and give the command to print it with -token-cmd.
 
 `
 
-var defaultTokenPath string // initalized in init() below
-
 func debugOut(msg interface{}) {
 	log.Printf("%s", msg)
 }
 
 func init() {
-	home := ""
-
-	// If we're statically linked, user.Current won't work.
-	if u, err := user.Current(); err == nil {
-		home = u.HomeDir
-	} else {
-		home = os.Getenv("HOME")
-	}
-	// If we don't have HOME in our environment, we might be
-	// running under something like a systemd chroot.  Check the
-	// chroot root.
-	defaultTokenPath = fmt.Sprintf("%s/.slack-token", home)
-
 	flag.StringVar(&offline, "offline", "",
 		"specified JSON info response file to use offline")
-	flag.StringVar(&tokenPath, "token-path", "", "Slack API token")
+
+	// these override the config file; their defaults are only
+	// for -help, the real ones come from slackfs.NewConfig.
+	defaults := slackfs.NewConfig()
+	flag.Var(&tokenPaths, "token-path", "file containing a Slack API token")
+	flag.Var(&tokenCmds, "token-cmd", "command printing a Slack API token")
+	flag.String("cache-dir", defaults.CacheDir,
+		"directory to cache room history in (empty disables)")
+	flag.Int("session-window", defaults.SessionWindow,
+		"bytes of each room's session to keep in memory (0 for unlimited)")
+	flag.String("spill-dir", "",
+		"directory for session text beyond -session-window (default system temp dir)")
+	flag.Int("history", defaults.History,
+		"messages to fetch per room on startup (default unread + 100)")
+	flag.String("tz", "", "timezone to display times in (default local)")
+	flag.Var(&ignore, "ignore", "hide messages from this user (repeatable)")
+	flag.Var(&highlight, "highlight", "highlight this keyword (repeatable)")
+	flag.Bool("allow-rmdir", false,
+		"let rmdir in channels/by-id and groups/by-id archive or leave rooms")
 
 	flag.BoolVar(&verbose, "v", false, "verbose logging (fs)")
 }
 
-var offline, tokenPath string
+var offline string
+var tokenPaths, tokenCmds, ignore, highlight slackfs.StringList
 var verbose bool
 
-func getToken(flagPath string) string {
-	path := defaultTokenPath
-	if envPath := os.Getenv("SLACKFS_TOKEN_PATH"); envPath != "" {
-		path = envPath
-	}
-	if flagPath != "" {
-		path = flagPath
-	}
-	if path == "" {
-		return ""
-	}
-	buf, err := ioutil.ReadFile(path)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error reading token file: %s\n\n", err)
-		return ""
-	}
-	return string(bytes.TrimSpace(buf))
-}
+func fsMain(cfg *slackfs.Config) {
+	mountpoint := cfg.Mountpoint
 
-func fsMain(mountpoint string) {
-	token := getToken(tokenPath)
-	if token == "" {
-		fmt.Fprintf(os.Stderr, noTokenFound)
-		flag.Usage()
-		os.Exit(1)
+	// keep tokens out of the log, whatever ends up in it.
+	log.SetOutput(slackfs.RedactWriter{W: os.Stderr})
+
+	// slack-cli only serves one team, the first one configured.
+	var token string
+	if offline == "" {
+		tokens, errs := cfg.Tokens()
+		for _, err := range errs {
+			log.Printf("%s", err)
+		}
+		if len(tokens) == 0 {
+			fmt.Fprintf(os.Stderr, noTokenFound)
+			flag.Usage()
+			os.Exit(1)
+		}
+		token = tokens[0]
 	}
 
 	var debugFn func(msg interface{})
@@ -129,16 +125,42 @@ func fsMain(mountpoint string) {
 		log.Fatalf("couldn't create mountpoint: %s", err)
 	}
 
+	opts, err := cfg.Options()
+	if err != nil {
+		log.Fatalf("config: %s", err)
+	}
+
 	var conn *slackfs.FSConn
 	if offline != "" {
-		conn, err = slackfs.NewOfflineFSConn(offline)
+		conn, err = slackfs.NewOfflineFSConn(offline, opts)
 	} else {
-		conn, err = slackfs.NewFSConn(token)
+		conn, err = slackfs.NewFSConn(token, opts)
 	}
 	if err != nil {
 		log.Fatalf("NewFS: %s", err)
 	}
 
+	// reload the parts of the config that can change while
+	// mounted on SIGHUP.
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			cfg, err := loadConfig()
+			if err != nil {
+				log.Printf("reload: %s", err)
+				continue
+			}
+			opts, err := cfg.Options()
+			if err != nil {
+				log.Printf("reload: %s", err)
+				continue
+			}
+			conn.Reload(opts)
+			log.Printf("reloaded config")
+		}
+	}()
+
 	c, err := fuse.Mount(
 		mountpoint,
 		fuse.FSName("slack"),
@@ -151,6 +173,7 @@ func fsMain(mountpoint string) {
 	}
 	defer c.Close()
 	defer fuse.Unmount(mountpoint)
+	defer conn.Close()
 	defer func() {
 		log.Printf("closed + unmounted fs")
 	}()
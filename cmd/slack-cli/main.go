@@ -12,24 +12,46 @@ import (
 	"time"
 
 	"github.com/bpowers/go-tmux"
+	"github.com/bpowers/slackfs"
 	"github.com/kardianos/osext"
 )
 
-const usage = `Usage: %s [OPTION...] MOUNTPOINT
+const usage = `Usage: %s [OPTION...]
 Command line slack client implemented with slackfs + tmux.
 
-If run with the -fs flag, the -token-path option or the
-SLACKFS_TOKEN_PATH environmental variable can be used to specify the
-location of a file containing your slack API token.  If neither is
-set, the default token file location of '%s' is tried.
+Options are read from the config file (by default '%s'), and
+can be overridden by the flags below.  This includes the mountpoint
+and the name of the tmux session.
+
+If run with the -fs flag, your slack API token is read from the
+output of -token-cmd (e.g. 'pass show slack'), or from the file given
+by -token-path.  Without either, the SLACKFS_TOKEN and
+SLACKFS_TOKEN_PATH environmental variables are checked, then the
+config file, and finally the default token file location of '%s'.
+Token files must not be readable by group or other.
 
 Options:
 `
 
 var memProfile, cpuProfile string
 
-const mountpoint = "/tmp/slack"
-const sessionName = "slack"
+// set from the config file and flags in main
+var mountpoint, sessionName string
+
+var configPath string
+
+// loadConfig reads the config file, and then applies any overrides
+// from the command line.
+func loadConfig() (*slackfs.Config, error) {
+	cfg, err := slackfs.LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.ApplyFlags(flag.CommandLine); err != nil {
+		return nil, fmt.Errorf("flags: %s", err)
+	}
+	return cfg, nil
+}
 
 func CreateWindow(mountpoint, kind, name string) error {
 	tmuxName := strings.Replace(name, ".", "_", -1)
@@ -50,7 +72,7 @@ func CreateWindow(mountpoint, kind, name string) error {
 
 	tmux.SplitWindow(target+".0", "-b", "-h", "unset TMUX; exec tmux attach -t slack-shared:sidebar")
 	tmux.ResizePane(target+".1", "-x", "24")
-	tmux.SplitWindow(target+".0", "-l", "2", "-v", fmt.Sprintf("cat >%s/write", dir))
+	tmux.SplitWindow(target+".0", "-l", "2", "-v", fmt.Sprintf("cat >%s/write.line", dir))
 	tmux.SelectPane(target + ".2")
 
 	return nil
@@ -87,11 +109,17 @@ func main() {
 	flag.StringVar(&cpuProfile, "cpuprofile", "",
 		"write cpu profile to this file")
 
+	flag.StringVar(&configPath, "config", slackfs.DefaultConfigPath(),
+		"config file")
+	defaults := slackfs.NewConfig()
+	flag.String("mountpoint", defaults.Mountpoint, "where to mount slackfs")
+	flag.String("session-name", defaults.SessionName, "tmux session name")
+
 	sidebar := flag.Bool("sidebar", false, "is a sidebar")
 	fs := flag.Bool("fs", false, "is slackfs")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		fmt.Fprintf(os.Stderr, usage, os.Args[0], slackfs.DefaultConfigPath(), slackfs.DefaultTokenPath())
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -106,14 +134,37 @@ func main() {
 		os.Exit(1)
 	}
 
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("config: %s", err)
+	}
+	mountpoint = cfg.Mountpoint
+	sessionName = cfg.SessionName
+
 	if *sidebar {
 		sidebarMain(mountpoint)
 		return
 	} else if *fs {
-		fsMain(mountpoint)
+		fsMain(cfg)
 		return
 	}
 
+	// the -fs and -sidebar processes we start need the same
+	// config we have, so pass our flags along.
+	var childArgs []string
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "sidebar" || f.Name == "fs" {
+			return
+		}
+		if l, ok := f.Value.(*slackfs.StringList); ok {
+			for _, val := range *l {
+				childArgs = append(childArgs, "-"+f.Name, val)
+			}
+			return
+		}
+		childArgs = append(childArgs, "-"+f.Name+"="+f.Value.String())
+	})
+
 	exe, err := osext.Executable()
 	if err != nil {
 		log.Fatalf("unable to get path to current executable")
@@ -121,7 +172,8 @@ func main() {
 
 	var session tmux.Session
 	if session, err = tmux.GetSession("slack-shared"); err != nil {
-		session, err = tmux.NewSession("slack-shared", "slackfs", exe, "-fs")
+		args := append([]string{exe, "-fs"}, childArgs...)
+		session, err = tmux.NewSession("slack-shared", "slackfs", args...)
 		if err != nil {
 			log.Fatalf("NewSession: %s", err)
 		}
@@ -136,7 +188,8 @@ func main() {
 	var window tmux.Window
 	if window, err = tmux.GetWindow("sidebar"); err != nil || window.SessionName != session.Name {
 		target := fmt.Sprintf("%s:1", session.Name)
-		window, err = tmux.NewWindow(target, "sidebar", exe, "-sidebar")
+		args := append([]string{exe, "-sidebar"}, childArgs...)
+		window, err = tmux.NewWindow(target, "sidebar", args...)
 		if err != nil {
 			log.Fatalf("NewWindow: %s", err)
 		}
@@ -5,14 +5,11 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
-	"os/user"
 	"syscall"
 
 	"github.com/bpowers/fuse"
@@ -21,95 +18,127 @@ import (
 )
 
 const (
-	usage = `Usage: %s [OPTION...] MOUNTPOINT
+	usage = `Usage: %s [OPTION...] [MOUNTPOINT]
 Slack as a filesystem.
 
-The -token-path option or the SLACKFS_TOKEN_PATH environmental
-variable can be used to specify the location of a file containing your
-slack API token.  If neither is set, the default token file location
-of '%s' is tried.
+Options are read from the config file (by default '%s'), and
+can be overridden by the flags below.  The mountpoint may be given
+in the config file as well.  On SIGHUP, the timezone, templates,
+ignored users and highlights are reloaded from the config file.
+
+Your slack API token is read from the output of -token-cmd (e.g.
+'pass show slack'), or from the file given by -token-path.  Without
+either, the SLACKFS_TOKEN and SLACKFS_TOKEN_PATH environmental
+variables are checked, then the config file, and finally the default
+token file location of '%s'.  Token files must not be readable by
+group or other.
+
+To mount several teams at once, give -token-path or -token-cmd once
+per team.  Each team is then served under teams/<team-id>/, linked to
+from teams/<domain>, with self linking to the first team's self/.
 
 Options:
 `
 
-	noTokenFound = `No token file could be read.  If you haven't generated one yet, go to
+	noTokenFound = `No token could be read.  If you haven't generated one yet, go to
 https://api.slack.com/web and scroll to the bottom. If 'none' is
 listed as the token, then click the green 'Create Token' button next
 to it. Copy the token that appears in red into an otherwise empty file
 stored at ~/.slack-token (or a location of your choosing, specified in
 the environment by SLACKFS_TOKEN_PATH or after the commandline flag
--token-path).
+-token-path), and 'chmod 600' it.  Alternatively, store it in a
+password manager and give the command to print it with -token-cmd.
 
 `
 )
 
-var defaultTokenPath string // initalized in init() below
-
 func debugOut(msg interface{}) {
 	log.Printf("%s", msg)
 }
 
-func init() {
-	home := ""
-
-	// If we're statically linked, user.Current won't work.
-	if u, err := user.Current(); err == nil {
-		home = u.HomeDir
-	} else {
-		home = os.Getenv("HOME")
-	}
-	// If we don't have HOME in our environment, we might be
-	// running under something like a systemd chroot.  Check the
-	// chroot root.
-	defaultTokenPath = fmt.Sprintf("%s/.slack-token", home)
-}
-
-func getToken(flagPath string) string {
-	path := defaultTokenPath
-	if envPath := os.Getenv("SLACKFS_TOKEN_PATH"); envPath != "" {
-		path = envPath
-	}
-	if flagPath != "" {
-		path = flagPath
-	}
-	if path == "" {
-		return ""
-	}
-	buf, err := ioutil.ReadFile(path)
+// loadConfig reads the config file, and then applies any overrides
+// from the command line.
+func loadConfig(path string) (*slackfs.Config, error) {
+	cfg, err := slackfs.LoadConfig(path)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error reading token file: %s\n\n", err)
-		return ""
+		return nil, err
+	}
+	if err = cfg.ApplyFlags(flag.CommandLine); err != nil {
+		return nil, fmt.Errorf("flags: %s", err)
 	}
-	return string(bytes.TrimSpace(buf))
+	return cfg, nil
 }
 
 var memProfile, cpuProfile string
 
 func main() {
+	// keep tokens out of the log, whatever ends up in it.
+	log.SetOutput(slackfs.RedactWriter{W: os.Stderr})
+
 	flag.StringVar(&memProfile, "memprofile", "",
 		"write memory profile to this file")
 	flag.StringVar(&cpuProfile, "cpuprofile", "",
 		"write cpu profile to this file")
 	offline := flag.String("offline", "",
 		"specified JSON info response file to use offline")
-	tokenPath := flag.String("token-path", "", "Slack API token")
+	configPath := flag.String("config", slackfs.DefaultConfigPath(),
+		"config file")
+
+	// these override the config file; their defaults are only
+	// for -help, the real ones come from slackfs.NewConfig.
+	defaults := slackfs.NewConfig()
+	var tokenPaths, tokenCmds, ignore, highlight slackfs.StringList
+	flag.Var(&tokenPaths, "token-path",
+		"file containing a Slack API token (repeat for several teams)")
+	flag.Var(&tokenCmds, "token-cmd",
+		"command printing a Slack API token (repeat for several teams)")
+	flag.String("cache-dir", defaults.CacheDir,
+		"directory to cache room history in (empty disables)")
+	flag.Int("session-window", defaults.SessionWindow,
+		"bytes of each room's session to keep in memory (0 for unlimited)")
+	flag.String("spill-dir", "",
+		"directory for session text beyond -session-window (default system temp dir)")
+	flag.Int("history", defaults.History,
+		"messages to fetch per room on startup (default unread + 100)")
+	flag.String("tz", "", "timezone to display times in (default local)")
+	flag.Var(&ignore, "ignore", "hide messages from this user (repeatable)")
+	flag.Var(&highlight, "highlight", "highlight this keyword (repeatable)")
+	flag.Bool("allow-rmdir", false,
+		"let rmdir in channels/by-id and groups/by-id archive or leave rooms")
 
 	verbose := flag.Bool("v", false, "verbose FUSE logging")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, usage, os.Args[0], defaultTokenPath)
+		fmt.Fprintf(os.Stderr, usage, os.Args[0], slackfs.DefaultConfigPath(), slackfs.DefaultTokenPath())
 		flag.PrintDefaults()
 	}
 	flag.Parse()
-	if flag.NArg() != 1 {
+	if flag.NArg() > 1 {
 		flag.Usage()
 		os.Exit(1)
 	}
-	token := getToken(*tokenPath)
-	if token == "" {
-		fmt.Fprintf(os.Stderr, noTokenFound)
-		flag.Usage()
-		os.Exit(1)
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("config: %s", err)
+	}
+	if flag.NArg() == 1 {
+		cfg.Mountpoint = flag.Arg(0)
+	}
+
+	var tokens []string
+	if *offline == "" {
+		// with several teams, an unreadable token file
+		// shouldn't keep us from serving the rest.
+		var errs []error
+		tokens, errs = cfg.Tokens()
+		for _, err := range errs {
+			log.Printf("%s", err)
+		}
+		if len(tokens) == 0 {
+			fmt.Fprintf(os.Stderr, noTokenFound)
+			flag.Usage()
+			os.Exit(1)
+		}
 	}
 
 	var debugFn func(msg interface{})
@@ -117,7 +146,7 @@ func main() {
 		debugFn = debugOut
 	}
 
-	mountpoint := flag.Arg(0)
+	mountpoint := cfg.Mountpoint
 
 	prof, err := slackfs.NewProf(memProfile, cpuProfile)
 	if err != nil {
@@ -155,16 +184,71 @@ func main() {
 		}
 	}
 
-	var conn *slackfs.FSConn
-	if *offline != "" {
-		conn, err = slackfs.NewOfflineFSConn(*offline)
-	} else {
-		conn, err = slackfs.NewFSConn(token)
-	}
+	opts, err := cfg.Options()
 	if err != nil {
-		log.Fatalf("NewFS: %s", err)
+		log.Fatalf("config: %s", err)
 	}
 
+	var super *slackfs.Super
+	var reload func(opts *slackfs.Options)
+	var closeConns func()
+	if *offline != "" || len(tokens) == 1 {
+		var conn *slackfs.FSConn
+		if *offline != "" {
+			conn, err = slackfs.NewOfflineFSConn(*offline, opts)
+		} else {
+			conn, err = slackfs.NewFSConn(tokens[0], opts)
+		}
+		if err != nil {
+			log.Fatalf("NewFS: %s", err)
+		}
+		super = conn.Super
+		reload = conn.Reload
+		closeConns = conn.Close
+	} else {
+		teams, err := slackfs.NewTeams()
+		if err != nil {
+			log.Fatalf("NewTeams: %s", err)
+		}
+		// teams we can't reach now are retried in the
+		// background, but we need at least one to start.
+		for i, token := range tokens {
+			conn, err := teams.Add(token, opts)
+			if err != nil {
+				log.Printf("team %d: %s", i+1, err)
+				continue
+			}
+			log.Printf("team %d: connected to %s", i+1, conn.Domain())
+		}
+		if teams.Len() == 0 {
+			log.Fatalf("couldn't connect to any team")
+		}
+		super = teams.Super
+		reload = teams.Reload
+		closeConns = teams.Close
+	}
+
+	// reload the parts of the config that can change while
+	// mounted on SIGHUP.
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			cfg, err := loadConfig(*configPath)
+			if err != nil {
+				log.Printf("reload: %s", err)
+				continue
+			}
+			opts, err := cfg.Options()
+			if err != nil {
+				log.Printf("reload: %s", err)
+				continue
+			}
+			reload(opts)
+			log.Printf("reloaded config")
+		}
+	}()
+
 	c, err := fuse.Mount(
 		mountpoint,
 		fuse.FSName("slack"),
@@ -177,6 +261,7 @@ func main() {
 	}
 	defer c.Close()
 	defer fuse.Unmount(mountpoint)
+	defer closeConns()
 	defer func() {
 		log.Printf("closed + unmounted fs")
 	}()
@@ -189,7 +274,7 @@ func main() {
 
 	log.Printf("FS ready, serving requests")
 
-	err = fs.Serve(c, conn.Super, debugFn)
+	err = fs.Serve(c, super, debugFn)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,269 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Config is the contents of the configuration file shared by slackfs
+// and slack-cli (see DefaultConfigPath).  Each line is 'key = value';
+// blank lines and lines starting with '#' are ignored.  Keys marked
+// as lists below may be given more than once.  Values may be written
+// as Go string literals ("...") to include escapes like \t and \n,
+// which is mostly useful for templates.  Keys match the names of the
+// corresponding command line flags, which override them.
+type Config struct {
+	TokenPaths    []string // token-path (list)
+	TokenCmds     []string // token-cmd (list): prints a token
+	Mountpoint    string   // mountpoint
+	SessionName   string   // session-name: slack-cli's tmux session
+	TZ            string   // tz
+	History       int      // history: messages fetched per room
+	CacheDir      string   // cache-dir: empty disables caching
+	SessionWindow int      // session-window
+	SpillDir      string   // spill-dir: empty uses the system temp dir
+	AllowRmdir    bool     // allow-rmdir
+
+	// true if token-path or token-cmd were given as flags, which
+	// take precedence over the environment (see Tokens).
+	tokensFromFlags bool
+
+	// these are reloaded on SIGHUP.
+	Templates Templates // template, template-edited, template-deleted
+	Ignore    []string  // ignore (list): usernames or IDs
+	Highlight []string  // highlight (list): keywords
+}
+
+// configKeys are the keys Config.Set accepts.
+var configKeys = map[string]bool{
+	"token-path":       true,
+	"token-cmd":        true,
+	"mountpoint":       true,
+	"session-name":     true,
+	"tz":               true,
+	"history":          true,
+	"cache-dir":        true,
+	"session-window":   true,
+	"spill-dir":        true,
+	"allow-rmdir":      true,
+	"template":         true,
+	"template-edited":  true,
+	"template-deleted": true,
+	"ignore":           true,
+	"highlight":        true,
+}
+
+// DefaultConfigPath returns $XDG_CONFIG_HOME/slackfs/config, falling
+// back to ~/.config/slackfs/config.
+func DefaultConfigPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "slackfs", "config")
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".config", "slackfs", "config")
+	}
+	return ""
+}
+
+// NewConfig returns a Config holding the defaults.
+func NewConfig() *Config {
+	return &Config{
+		Mountpoint:    "/tmp/slack",
+		SessionName:   "slack",
+		CacheDir:      DefaultCacheDir(),
+		SessionWindow: 4 << 20,
+	}
+}
+
+// LoadConfig reads the config file at path on top of the defaults.
+// A missing file is not an error.
+func LoadConfig(path string) (*Config, error) {
+	c := NewConfig()
+	if path == "" {
+		return c, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Open(%s): %s", path, err)
+	}
+	defer f.Close()
+
+	lineNo := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: expected 'key = value'", path, lineNo)
+		}
+		key := strings.TrimSpace(line[:i])
+		val := strings.TrimSpace(line[i+1:])
+		if strings.HasPrefix(val, `"`) {
+			if val, err = strconv.Unquote(val); err != nil {
+				return nil, fmt.Errorf("%s:%d: bad string: %s", path, lineNo, err)
+			}
+		}
+		if err = c.Set(key, val); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, lineNo, err)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Scan(%s): %s", path, err)
+	}
+
+	return c, nil
+}
+
+// expandHome replaces a leading ~/ in path with $HOME.
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[2:])
+	}
+	return path
+}
+
+// Set sets the config key to val.  For list keys, val is appended.
+func (c *Config) Set(key, val string) error {
+	var err error
+	switch key {
+	case "token-path":
+		c.TokenPaths = append(c.TokenPaths, expandHome(val))
+	case "token-cmd":
+		c.TokenCmds = append(c.TokenCmds, val)
+	case "mountpoint":
+		c.Mountpoint = expandHome(val)
+	case "session-name":
+		c.SessionName = val
+	case "tz":
+		c.TZ = val
+	case "history":
+		c.History, err = strconv.Atoi(val)
+	case "cache-dir":
+		c.CacheDir = expandHome(val)
+	case "session-window":
+		c.SessionWindow, err = strconv.Atoi(val)
+	case "spill-dir":
+		c.SpillDir = expandHome(val)
+	case "allow-rmdir":
+		c.AllowRmdir, err = strconv.ParseBool(val)
+	case "template":
+		c.Templates.Msg = val
+	case "template-edited":
+		c.Templates.Edited = val
+	case "template-deleted":
+		c.Templates.Deleted = val
+	case "ignore":
+		c.Ignore = append(c.Ignore, val)
+	case "highlight":
+		c.Highlight = append(c.Highlight, val)
+	default:
+		return fmt.Errorf("unknown key '%s'", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", key, err)
+	}
+	return nil
+}
+
+// StringList is a flag.Value for flags that may be given more than
+// once, like -token-path.
+type StringList []string
+
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(val string) error {
+	*l = append(*l, val)
+	return nil
+}
+
+// ApplyFlags overrides the config with the flags in set that were
+// given on the command line and share a name with a config key.
+// List flags replace, rather than add to, the config file's list,
+// and token sources given as flags replace all of the config file's.
+func (c *Config) ApplyFlags(set *flag.FlagSet) error {
+	var err error
+	set.Visit(func(f *flag.Flag) {
+		if f.Name == "token-path" || f.Name == "token-cmd" {
+			c.TokenPaths, c.TokenCmds = nil, nil
+			c.tokensFromFlags = true
+		}
+	})
+	set.Visit(func(f *flag.Flag) {
+		if err != nil || !configKeys[f.Name] {
+			return
+		}
+		if l, ok := f.Value.(*StringList); ok {
+			switch f.Name {
+			case "ignore":
+				c.Ignore = nil
+			case "highlight":
+				c.Highlight = nil
+			}
+			for _, val := range *l {
+				if err = c.Set(f.Name, val); err != nil {
+					return
+				}
+			}
+			return
+		}
+		err = c.Set(f.Name, f.Value.String())
+	})
+	return err
+}
+
+// Options returns the FSConn options described by the config.
+func (c *Config) Options() (*Options, error) {
+	opts := &Options{
+		CacheDir:      c.CacheDir,
+		SessionWindow: c.SessionWindow,
+		SpillDir:      c.SpillDir,
+		History:       c.History,
+		AllowRmdir:    c.AllowRmdir,
+		Templates:     c.Templates,
+		Ignore:        c.Ignore,
+		Highlight:     c.Highlight,
+	}
+	if c.TZ != "" {
+		loc, err := time.LoadLocation(c.TZ)
+		if err != nil {
+			return nil, fmt.Errorf("LoadLocation(%s): %s", c.TZ, err)
+		}
+		opts.Location = loc
+	}
+
+	// catch template errors now, rather than on every message.
+	for name, tmpl := range map[string]string{
+		"template":         c.Templates.Msg,
+		"template-edited":  c.Templates.Edited,
+		"template-deleted": c.Templates.Deleted,
+	} {
+		if tmpl == "" {
+			continue
+		}
+		if _, err := template.New(name).Funcs(msgFuncs(nil)).Parse(tmpl); err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigSet(t *testing.T) {
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", "/home/test")
+	for _, tc := range []struct {
+		key, val string
+		ok       bool
+		check    func(c *Config) bool
+	}{
+		{"mountpoint", "~/slack", true, func(c *Config) bool { return c.Mountpoint == "/home/test/slack" }},
+		{"mountpoint", "/mnt/slack", true, func(c *Config) bool { return c.Mountpoint == "/mnt/slack" }},
+		{"history", "50", true, func(c *Config) bool { return c.History == 50 }},
+		{"history", "lots", false, nil},
+		{"session-window", "1024", true, func(c *Config) bool { return c.SessionWindow == 1024 }},
+		{"spill-dir", "~/spill", true, func(c *Config) bool { return c.SpillDir == "/home/test/spill" }},
+		{"allow-rmdir", "true", true, func(c *Config) bool { return c.AllowRmdir }},
+		{"allow-rmdir", "sure", false, nil},
+		{"token-path", "~/.tok", true, func(c *Config) bool {
+			return reflect.DeepEqual(c.TokenPaths, []string{"/home/test/.tok"})
+		}},
+		{"ignore", "bob", true, func(c *Config) bool { return reflect.DeepEqual(c.Ignore, []string{"bob"}) }},
+		{"template", "{{.Text}}", true, func(c *Config) bool { return c.Templates.Msg == "{{.Text}}" }},
+		{"no-such-key", "x", false, nil},
+	} {
+		c := NewConfig()
+		err := c.Set(tc.key, tc.val)
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("Set(%s, %q): err = %v, want ok = %v", tc.key, tc.val, err, tc.ok)
+			continue
+		}
+		if tc.check != nil && !tc.check(c) {
+			t.Errorf("Set(%s, %q): got %#v", tc.key, tc.val, c)
+		}
+	}
+}
+
+func TestConfigListsAppend(t *testing.T) {
+	c := NewConfig()
+	for _, val := range []string{"a", "b"} {
+		if err := c.Set("highlight", val); err != nil {
+			t.Fatalf("Set: %s", err)
+		}
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(c.Highlight, want) {
+		t.Errorf("Highlight = %q, want %q", c.Highlight, want)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slackfs-config-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := LoadConfig(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatalf("LoadConfig(missing): %s", err)
+	}
+	if !reflect.DeepEqual(c, NewConfig()) {
+		t.Errorf("LoadConfig(missing) = %#v, want defaults", c)
+	}
+
+	path := filepath.Join(dir, "config")
+	content := "# comment\n\nhistory = 25\ntemplate = \"{{.Text}}\\n\"\nignore = a\nignore = b\n"
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if c, err = LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig: %s", err)
+	}
+	if c.History != 25 || c.Templates.Msg != "{{.Text}}\n" || !reflect.DeepEqual(c.Ignore, []string{"a", "b"}) {
+		t.Errorf("LoadConfig = %#v", c)
+	}
+	if c.Mountpoint != NewConfig().Mountpoint {
+		t.Errorf("unset key lost its default: %q", c.Mountpoint)
+	}
+
+	for _, bad := range []string{"history\n", "history = x\n", "nope = 1\n", "template = \"unterminated\n"} {
+		if err = ioutil.WriteFile(path, []byte(bad), 0600); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		if _, err = LoadConfig(path); err == nil {
+			t.Errorf("LoadConfig(%q) succeeded", bad)
+		}
+	}
+}
+
+func newTestFlags(c *Config) *flag.FlagSet {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("mountpoint", c.Mountpoint, "")
+	set.Int("history", c.History, "")
+	set.Bool("allow-rmdir", c.AllowRmdir, "")
+	set.Bool("not-a-key", false, "")
+	set.Var(new(StringList), "ignore", "")
+	set.Var(new(StringList), "token-path", "")
+	set.Var(new(StringList), "token-cmd", "")
+	return set
+}
+
+func TestApplyFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		check func(c *Config) bool
+	}{
+		{"no flags keep the file's values", nil, func(c *Config) bool {
+			return c.Mountpoint == "/file" && c.History == 10 &&
+				reflect.DeepEqual(c.Ignore, []string{"file"}) &&
+				reflect.DeepEqual(c.TokenCmds, []string{"file-cmd"}) && !c.tokensFromFlags
+		}},
+		{"flags win", []string{"-mountpoint", "/flag", "-history", "5", "-allow-rmdir"}, func(c *Config) bool {
+			return c.Mountpoint == "/flag" && c.History == 5 && c.AllowRmdir
+		}},
+		{"defaults of unset flags don't override", []string{"-history", "5"}, func(c *Config) bool {
+			return c.Mountpoint == "/file"
+		}},
+		{"list flags replace", []string{"-ignore", "x", "-ignore", "y"}, func(c *Config) bool {
+			return reflect.DeepEqual(c.Ignore, []string{"x", "y"})
+		}},
+		{"token flags replace every token source", []string{"-token-path", "/tok"}, func(c *Config) bool {
+			return reflect.DeepEqual(c.TokenPaths, []string{"/tok"}) && c.TokenCmds == nil && c.tokensFromFlags
+		}},
+		{"flags that aren't keys are ignored", []string{"-not-a-key"}, func(c *Config) bool {
+			return c.Mountpoint == "/file"
+		}},
+	} {
+		c := NewConfig()
+		for _, kv := range [][2]string{{"mountpoint", "/file"}, {"history", "10"}, {"ignore", "file"}, {"token-cmd", "file-cmd"}} {
+			if err := c.Set(kv[0], kv[1]); err != nil {
+				t.Fatalf("Set: %s", err)
+			}
+		}
+		set := newTestFlags(c)
+		if err := set.Parse(tc.args); err != nil {
+			t.Fatalf("%s: Parse: %s", tc.name, err)
+		}
+		if err := c.ApplyFlags(set); err != nil {
+			t.Errorf("%s: ApplyFlags: %s", tc.name, err)
+			continue
+		}
+		if !tc.check(c) {
+			t.Errorf("%s: got %#v", tc.name, c)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/bpowers/fuse"
+	"github.com/bpowers/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+var errBadCtl = fuse.Errno(syscall.EINVAL)
+
+// Controller is implemented by rooms that can be administered by
+// writing commands to their ctl file.
+type Controller interface {
+	Ctl(cmd, arg string) error
+}
+
+// apiErrno maps Slack API error strings onto errnos, so that a
+// failed command is reported to the writer as something more useful
+// than EIO.
+func apiErrno(op string, err error) error {
+	log.Printf("%s: %s", op, err)
+
+	switch err.Error() {
+	case "channel_not_found", "user_not_found", "not_in_channel", "not_in_group":
+		return fuse.ENOENT
+	case "name_taken", "already_in_channel", "already_archived", "already_open":
+		return fuse.Errno(syscall.EEXIST)
+	case "invalid_name", "invalid_name_specials", "invalid_name_punctuation",
+		"invalid_name_maxlength", "invalid_name_required", "no_channel",
+		"too_long", "cant_invite_self", "cant_kick_self", "cant_archive_general",
+		"cant_leave_general", "cant_kick_from_general", "cant_leave_last_channel":
+		return fuse.Errno(syscall.EINVAL)
+	case "restricted_action", "not_authorized", "cant_kick_from_last_channel",
+		"is_archived", "user_is_bot", "user_is_restricted", "last_member":
+		return fuse.EPERM
+	}
+	return fuse.EIO
+}
+
+// ctlUser resolves the argument to invite/kick, which may be either a
+// username or a user ID.
+func (conn *FSConn) ctlUser(arg string) (*User, error) {
+	if arg == "" {
+		return nil, errBadCtl
+	}
+	u := conn.users.Lookup(strings.TrimPrefix(arg, "@"))
+	if u == nil {
+		return nil, fuse.ENOENT
+	}
+	return u, nil
+}
+
+// parseCtl splits a ctl line into a command and its (possibly
+// empty) argument.
+func parseCtl(line string) (cmd, arg string) {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		return line[:i], strings.TrimSpace(line[i+1:])
+	}
+	return line, ""
+}
+
+type roomCtlNode struct {
+	AttrNode
+}
+
+func newRoomCtl(parent *DirNode) (INode, error) {
+	name := "ctl"
+	n := new(roomCtlNode)
+	if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+		return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+	}
+	n.Update()
+	n.mode = 0222
+	return n, nil
+}
+
+func (n *roomCtlNode) Update() {
+}
+
+func (n *roomCtlNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	c, ok := n.parent.priv.(Controller)
+	if !ok {
+		log.Printf("priv is not Controller")
+		return nil, fuse.ENOSYS
+	}
+
+	h := new(roomCtlHandle)
+	h.c = c
+	return h, nil
+}
+
+// roomCtlHandle buffers writes to an open ctl file, so that a
+// command split across several writes is run once, whole.
+type roomCtlHandle struct {
+	c Controller
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (h *roomCtlHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buf.Write(req.Data)
+	resp.Size = len(req.Data)
+
+	// each line is a separate command.  Stop at the first
+	// failure so that the writer sees the error.
+	for {
+		i := bytes.IndexByte(h.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		if err := h.run(h.buf.Next(i + 1)); err != nil {
+			h.buf.Reset()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// must be called with h.mu held
+func (h *roomCtlHandle) run(line []byte) error {
+	cmd, arg := parseCtl(string(line))
+	if cmd == "" {
+		return nil
+	}
+	return h.c.Ctl(cmd, arg)
+}
+
+// must be called with h.mu held
+func (h *roomCtlHandle) flush() error {
+	err := h.run(h.buf.Bytes())
+	h.buf.Reset()
+	return err
+}
+
+// Flush is called on every close(2) of the handle, so that a final
+// command without a trailing newline is run and its error reported
+// to the writer.
+func (h *roomCtlHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flush()
+}
+
+func (h *roomCtlHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flush()
+}
+
+func (n *roomCtlNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
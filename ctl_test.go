@@ -0,0 +1,111 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/bpowers/fuse"
+)
+
+func TestParseCtl(t *testing.T) {
+	for _, tc := range []struct {
+		line     string
+		cmd, arg string
+	}{
+		{"", "", ""},
+		{"   ", "", ""},
+		{"archive", "archive", ""},
+		{"archive\n", "archive", ""},
+		{"  join  ", "join", ""},
+		{"topic a new topic", "topic", "a new topic"},
+		{"topic\ta  new  topic \r\n", "topic", "a  new  topic"},
+		{"invite @bobby", "invite", "@bobby"},
+		{"topic ", "topic", ""},
+	} {
+		cmd, arg := parseCtl(tc.line)
+		if cmd != tc.cmd || arg != tc.arg {
+			t.Errorf("parseCtl(%q) = %q, %q, want %q, %q", tc.line, cmd, arg, tc.cmd, tc.arg)
+		}
+	}
+}
+
+func TestApiErrno(t *testing.T) {
+	for _, tc := range []struct {
+		err   string
+		errno error
+	}{
+		{"channel_not_found", fuse.ENOENT},
+		{"not_in_channel", fuse.ENOENT},
+		{"name_taken", fuse.Errno(syscall.EEXIST)},
+		{"already_archived", fuse.Errno(syscall.EEXIST)},
+		{"invalid_name", fuse.Errno(syscall.EINVAL)},
+		{"cant_archive_general", fuse.Errno(syscall.EINVAL)},
+		{"restricted_action", fuse.EPERM},
+		{"is_archived", fuse.EPERM},
+		{"some_new_error", fuse.EIO},
+		{"", fuse.EIO},
+	} {
+		if errno := apiErrno("test", errors.New(tc.err)); errno != tc.errno {
+			t.Errorf("apiErrno(%q) = %v, want %v", tc.err, errno, tc.errno)
+		}
+	}
+}
+
+type testController struct {
+	cmds []string
+	err  error
+}
+
+func (c *testController) Ctl(cmd, arg string) error {
+	c.cmds = append(c.cmds, cmd+"("+arg+")")
+	return c.err
+}
+
+func TestRoomCtlHandle(t *testing.T) {
+	c := new(testController)
+	h := &roomCtlHandle{c: c}
+
+	for _, data := range []string{"join\ntop", "ic split ", "across writes\n", "arch", "ive"} {
+		var resp fuse.WriteResponse
+		if err := h.Write(nil, &fuse.WriteRequest{Data: []byte(data)}, &resp); err != nil {
+			t.Fatalf("Write(%q): %s", data, err)
+		}
+		if resp.Size != len(data) {
+			t.Errorf("Write(%q): size %d", data, resp.Size)
+		}
+	}
+	if len(c.cmds) != 2 {
+		t.Fatalf("before flush: %q", c.cmds)
+	}
+	if err := h.Flush(nil, nil); err != nil {
+		t.Fatalf("Flush: %s", err)
+	}
+	if err := h.Release(nil, nil); err != nil {
+		t.Fatalf("Release: %s", err)
+	}
+
+	want := []string{"join()", "topic(split across writes)", "archive()"}
+	if len(c.cmds) != len(want) {
+		t.Fatalf("cmds = %q, want %q", c.cmds, want)
+	}
+	for i := range want {
+		if c.cmds[i] != want[i] {
+			t.Errorf("cmds[%d] = %q, want %q", i, c.cmds[i], want[i])
+		}
+	}
+
+	c = &testController{err: fuse.EPERM}
+	h = &roomCtlHandle{c: c}
+	var resp fuse.WriteResponse
+	if err := h.Write(nil, &fuse.WriteRequest{Data: []byte("archive\nleave\n")}, &resp); err != fuse.EPERM {
+		t.Errorf("Write: err = %v, want EPERM", err)
+	}
+	if len(c.cmds) != 1 {
+		t.Errorf("commands after a failure were run: %q", c.cmds)
+	}
+}
@@ -70,6 +70,61 @@ func (ds *DirSet) Add(id, name string, priv interface{}) error {
 	return nil
 }
 
+// Insert is Add for use after the DirSet has been activated: the new
+// directory and its by-name symlink are visible immediately.
+func (ds *DirSet) Insert(id, name string, priv interface{}) error {
+	if err := ds.Add(id, name, priv); err != nil {
+		return err
+	}
+	ds.objDirs[id].Activate()
+	ds.objSyms[name].Activate()
+	return nil
+}
+
+// Remove unlinks the directory for id along with any by-name
+// symlinks pointing at it.
+func (ds *DirSet) Remove(id string) error {
+	dir, ok := ds.objDirs[id]
+	if !ok {
+		return fmt.Errorf("unknown id '%s'", id)
+	}
+	for name, s := range ds.objSyms {
+		if s.target != dir {
+			continue
+		}
+		ds.byName.removeChild(name)
+		delete(ds.objSyms, name)
+	}
+	ds.byId.removeChild(id)
+	delete(ds.objDirs, id)
+	return nil
+}
+
+// Rename points the by-name symlink for id at a new name.
+func (ds *DirSet) Rename(id, name string) error {
+	dir, ok := ds.objDirs[id]
+	if !ok {
+		return fmt.Errorf("unknown id '%s'", id)
+	}
+	if s, ok := ds.objSyms[name]; ok && s.target == dir {
+		return nil
+	}
+	for oldName, s := range ds.objSyms {
+		if s.target != dir {
+			continue
+		}
+		ds.byName.removeChild(oldName)
+		delete(ds.objSyms, oldName)
+	}
+	s, err := NewSymlinkNode(ds.byName, name, dir)
+	if err != nil {
+		return fmt.Errorf("NewSymlinkNode(%s): %s", name, err)
+	}
+	ds.objSyms[name] = s
+	s.Activate()
+	return nil
+}
+
 func (ds *DirSet) Activate() {
 	for _, n := range ds.objDirs {
 		n.Activate()
@@ -0,0 +1,432 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+// emojiCodes maps the shortcodes of common standard emoji to their
+// Unicode representation.  It covers what shows up in practice
+// rather than the full Unicode emoji set.
+var emojiCodes = map[string]string{
+	"+1":                           "👍",
+	"-1":                           "👎",
+	"100":                          "💯",
+	"8ball":                        "🎱",
+	"airplane":                     "✈️",
+	"alarm_clock":                  "⏰",
+	"alien":                        "👽",
+	"angel":                        "👼",
+	"angry":                        "😠",
+	"ant":                          "🐜",
+	"apple":                        "🍎",
+	"arrow_down":                   "⬇️",
+	"arrow_left":                   "⬅️",
+	"arrow_right":                  "➡️",
+	"arrow_up":                     "⬆️",
+	"arrows_counterclockwise":      "🔄",
+	"art":                          "🎨",
+	"astonished":                   "😲",
+	"baby":                         "👶",
+	"balloon":                      "🎈",
+	"ballot_box_with_check":        "☑️",
+	"banana":                       "🍌",
+	"bangbang":                     "‼️",
+	"bar_chart":                    "📊",
+	"baseball":                     "⚾",
+	"basketball":                   "🏀",
+	"battery":                      "🔋",
+	"bear":                         "🐻",
+	"bee":                          "🐝",
+	"beer":                         "🍺",
+	"beers":                        "🍻",
+	"bell":                         "🔔",
+	"bike":                         "🚲",
+	"bird":                         "🐦",
+	"birthday":                     "🎂",
+	"black_circle":                 "⚫",
+	"blue_heart":                   "💙",
+	"blush":                        "😊",
+	"bomb":                         "💣",
+	"book":                         "📖",
+	"books":                        "📚",
+	"boom":                         "💥",
+	"bow":                          "🙇",
+	"boy":                          "👦",
+	"brain":                        "🧠",
+	"broken_heart":                 "💔",
+	"bug":                          "🐛",
+	"bulb":                         "💡",
+	"cactus":                       "🌵",
+	"cake":                         "🍰",
+	"calendar":                     "📆",
+	"camera":                       "📷",
+	"candle":                       "🕯️",
+	"car":                          "🚗",
+	"cat":                          "🐱",
+	"cd":                           "💿",
+	"chart_with_downwards_trend":   "📉",
+	"chart_with_upwards_trend":     "📈",
+	"checkered_flag":               "🏁",
+	"cherry_blossom":               "🌸",
+	"chicken":                      "🐔",
+	"christmas_tree":               "🎄",
+	"clap":                         "👏",
+	"clipboard":                    "📋",
+	"cloud":                        "☁️",
+	"clown_face":                   "🤡",
+	"cn":                           "🇨🇳",
+	"cocktail":                     "🍸",
+	"coffee":                       "☕",
+	"cold_sweat":                   "😰",
+	"collision":                    "💥",
+	"computer":                     "💻",
+	"confetti_ball":                "🎊",
+	"confounded":                   "😖",
+	"confused":                     "😕",
+	"construction":                 "🚧",
+	"construction_worker":          "👷",
+	"cookie":                       "🍪",
+	"cool":                         "🆒",
+	"cop":                          "👮",
+	"copyright":                    "©️",
+	"cow":                          "🐮",
+	"cowboy_hat_face":              "🤠",
+	"crab":                         "🦀",
+	"credit_card":                  "💳",
+	"crescent_moon":                "🌙",
+	"crown":                        "👑",
+	"cry":                          "😢",
+	"crystal_ball":                 "🔮",
+	"dancer":                       "💃",
+	"dark_sunglasses":              "🕶️",
+	"dart":                         "🎯",
+	"dash":                         "💨",
+	"date":                         "📅",
+	"de":                           "🇩🇪",
+	"deciduous_tree":               "🌳",
+	"desktop_computer":             "🖥️",
+	"disappointed":                 "😞",
+	"disappointed_relieved":        "😥",
+	"dizzy_face":                   "😵",
+	"dna":                          "🧬",
+	"dog":                          "🐶",
+	"dollar":                       "💵",
+	"dolphin":                      "🐬",
+	"doughnut":                     "🍩",
+	"ear":                          "👂",
+	"earth_africa":                 "🌍",
+	"earth_americas":               "🌎",
+	"earth_asia":                   "🌏",
+	"eight":                        "8️⃣",
+	"electric_plug":                "🔌",
+	"elephant":                     "🐘",
+	"email":                        "📧",
+	"envelope":                     "✉️",
+	"es":                           "🇪🇸",
+	"evergreen_tree":               "🌲",
+	"exclamation":                  "❗",
+	"exploding_head":               "🤯",
+	"expressionless":               "😑",
+	"eyeglasses":                   "👓",
+	"eyes":                         "👀",
+	"face_with_head_bandage":       "🤕",
+	"face_with_rolling_eyes":       "🙄",
+	"face_with_thermometer":        "🤒",
+	"facepalm":                     "🤦",
+	"facepunch":                    "👊",
+	"fearful":                      "😨",
+	"file_folder":                  "📁",
+	"fire":                         "🔥",
+	"fireworks":                    "🎆",
+	"fish":                         "🐟",
+	"fist":                         "✊",
+	"five":                         "5️⃣",
+	"flashlight":                   "🔦",
+	"floppy_disk":                  "💾",
+	"flushed":                      "😳",
+	"football":                     "🏈",
+	"footprints":                   "👣",
+	"four":                         "4️⃣",
+	"four_leaf_clover":             "🍀",
+	"fr":                           "🇫🇷",
+	"free":                         "🆓",
+	"fries":                        "🍟",
+	"frog":                         "🐸",
+	"full_moon":                    "🌕",
+	"game_die":                     "🎲",
+	"gb":                           "🇬🇧",
+	"gear":                         "⚙️",
+	"gem":                          "💎",
+	"ghost":                        "👻",
+	"gift":                         "🎁",
+	"girl":                         "👧",
+	"goat":                         "🐐",
+	"green_heart":                  "💚",
+	"grey_exclamation":             "❕",
+	"grey_question":                "❔",
+	"grin":                         "😁",
+	"grinning":                     "😀",
+	"guitar":                       "🎸",
+	"gun":                          "🔫",
+	"hamburger":                    "🍔",
+	"hammer":                       "🔨",
+	"hamster":                      "🐹",
+	"hand":                         "✋",
+	"hankey":                       "💩",
+	"hash":                         "#️⃣",
+	"hatching_chick":               "🐣",
+	"headphones":                   "🎧",
+	"hear_no_evil":                 "🙉",
+	"heart":                        "❤️",
+	"heart_eyes":                   "😍",
+	"heavy_check_mark":             "✔️",
+	"heavy_division_sign":          "➗",
+	"heavy_exclamation_mark":       "❗",
+	"heavy_minus_sign":             "➖",
+	"heavy_multiplication_x":       "✖️",
+	"heavy_plus_sign":              "➕",
+	"honeybee":                     "🐝",
+	"horse":                        "🐴",
+	"hospital":                     "🏥",
+	"hourglass":                    "⌛",
+	"hourglass_flowing_sand":       "⏳",
+	"house":                        "🏠",
+	"hugging_face":                 "🤗",
+	"hushed":                       "😯",
+	"imp":                          "👿",
+	"inbox_tray":                   "📥",
+	"infinity":                     "♾️",
+	"information_source":           "ℹ️",
+	"innocent":                     "😇",
+	"interrobang":                  "⁉️",
+	"iphone":                       "📱",
+	"it":                           "🇮🇹",
+	"jack_o_lantern":               "🎃",
+	"japanese_goblin":              "👺",
+	"japanese_ogre":                "👹",
+	"jeans":                        "👖",
+	"joy":                          "😂",
+	"jp":                           "🇯🇵",
+	"key":                          "🔑",
+	"keyboard":                     "⌨️",
+	"keycap_ten":                   "🔟",
+	"kiss":                         "💋",
+	"kissing_heart":                "😘",
+	"koala":                        "🐨",
+	"kr":                           "🇰🇷",
+	"large_blue_circle":            "🔵",
+	"laughing":                     "😆",
+	"link":                         "🔗",
+	"lion_face":                    "🦁",
+	"lips":                         "👄",
+	"lipstick":                     "💄",
+	"lock":                         "🔒",
+	"loudspeaker":                  "📢",
+	"lying_face":                   "🤥",
+	"mag":                          "🔍",
+	"man":                          "👨",
+	"man-shrugging":                "🤷‍♂️",
+	"maple_leaf":                   "🍁",
+	"mask":                         "😷",
+	"medal":                        "🏅",
+	"mega":                         "📣",
+	"memo":                         "📝",
+	"metal":                        "🤘",
+	"microphone":                   "🎤",
+	"microscope":                   "🔬",
+	"money_mouth_face":             "🤑",
+	"moneybag":                     "💰",
+	"monkey_face":                  "🐵",
+	"mouse":                        "🐭",
+	"movie_camera":                 "🎥",
+	"moyai":                        "🗿",
+	"muscle":                       "💪",
+	"musical_note":                 "🎵",
+	"nauseated_face":               "🤢",
+	"necktie":                      "👔",
+	"nerd_face":                    "🤓",
+	"neutral_face":                 "😐",
+	"new":                          "🆕",
+	"new_moon":                     "🌑",
+	"nine":                         "9️⃣",
+	"ninja":                        "🥷",
+	"no_bell":                      "🔕",
+	"no_entry":                     "⛔",
+	"no_entry_sign":                "🚫",
+	"no_good":                      "🙅",
+	"no_mouth":                     "😶",
+	"nose":                         "👃",
+	"notebook":                     "📓",
+	"notes":                        "🎶",
+	"ocean":                        "🌊",
+	"octopus":                      "🐙",
+	"office":                       "🏢",
+	"ok":                           "🆗",
+	"ok_hand":                      "👌",
+	"ok_woman":                     "🙆",
+	"older_man":                    "👴",
+	"older_woman":                  "👵",
+	"one":                          "1️⃣",
+	"open_file_folder":             "📂",
+	"open_mouth":                   "😮",
+	"outbox_tray":                  "📤",
+	"package":                      "📦",
+	"palm_tree":                    "🌴",
+	"panda_face":                   "🐼",
+	"paperclip":                    "📎",
+	"partying_face":                "🥳",
+	"pencil":                       "📝",
+	"pencil2":                      "✏️",
+	"penguin":                      "🐧",
+	"pensive":                      "😔",
+	"persevere":                    "😣",
+	"phone":                        "☎️",
+	"pig":                          "🐷",
+	"pill":                         "💊",
+	"pizza":                        "🍕",
+	"pleading_face":                "🥺",
+	"point_down":                   "👇",
+	"point_left":                   "👈",
+	"point_right":                  "👉",
+	"point_up":                     "☝️",
+	"poop":                         "💩",
+	"popcorn":                      "🍿",
+	"pray":                         "🙏",
+	"princess":                     "👸",
+	"punch":                        "👊",
+	"purple_heart":                 "💜",
+	"pushpin":                      "📌",
+	"question":                     "❓",
+	"rabbit":                       "🐰",
+	"rage":                         "😡",
+	"rainbow":                      "🌈",
+	"raised_hand":                  "✋",
+	"raised_hands":                 "🙌",
+	"raising_hand":                 "🙋",
+	"recycle":                      "♻️",
+	"red_circle":                   "🔴",
+	"registered":                   "®️",
+	"relaxed":                      "☺️",
+	"relieved":                     "😌",
+	"repeat":                       "🔁",
+	"ribbon":                       "🎀",
+	"ring":                         "💍",
+	"robot_face":                   "🤖",
+	"rocket":                       "🚀",
+	"rofl":                         "🤣",
+	"rose":                         "🌹",
+	"rotating_light":               "🚨",
+	"ru":                           "🇷🇺",
+	"runner":                       "🏃",
+	"running":                      "🏃",
+	"santa":                        "🎅",
+	"satellite":                    "📡",
+	"satisfied":                    "😆",
+	"school":                       "🏫",
+	"scissors":                     "✂️",
+	"scream":                       "😱",
+	"see_no_evil":                  "🙈",
+	"seedling":                     "🌱",
+	"seven":                        "7️⃣",
+	"sheep":                        "🐑",
+	"ship":                         "🚢",
+	"shirt":                        "👕",
+	"shit":                         "💩",
+	"shrug":                        "🤷",
+	"six":                          "6️⃣",
+	"skull":                        "💀",
+	"skull_and_crossbones":         "☠️",
+	"sleeping":                     "😴",
+	"sleepy":                       "😪",
+	"slightly_frowning_face":       "🙁",
+	"slightly_smiling_face":        "🙂",
+	"smile":                        "😄",
+	"smiley":                       "😃",
+	"smiling_imp":                  "😈",
+	"smirk":                        "😏",
+	"snail":                        "🐌",
+	"snake":                        "🐍",
+	"sneezing_face":                "🤧",
+	"snowflake":                    "❄️",
+	"snowman":                      "⛄",
+	"sob":                          "😭",
+	"soccer":                       "⚽",
+	"sos":                          "🆘",
+	"sparkler":                     "🎇",
+	"sparkles":                     "✨",
+	"sparkling_heart":              "💖",
+	"speak_no_evil":                "🙊",
+	"speech_balloon":               "💬",
+	"squirrel":                     "🐿️",
+	"star":                         "⭐",
+	"star-struck":                  "🤩",
+	"star2":                        "🌟",
+	"stopwatch":                    "⏱️",
+	"stuck_out_tongue":             "😛",
+	"stuck_out_tongue_winking_eye": "😜",
+	"sunflower":                    "🌻",
+	"sunglasses":                   "😎",
+	"sunny":                        "☀️",
+	"sweat":                        "😓",
+	"sweat_drops":                  "💦",
+	"sweat_smile":                  "😅",
+	"syringe":                      "💉",
+	"taco":                         "🌮",
+	"tada":                         "🎉",
+	"tea":                          "🍵",
+	"telephone_receiver":           "📞",
+	"telescope":                    "🔭",
+	"tennis":                       "🎾",
+	"thinking_face":                "🤔",
+	"thought_balloon":              "💭",
+	"three":                        "3️⃣",
+	"thumbsdown":                   "👎",
+	"thumbsup":                     "👍",
+	"tiger":                        "🐯",
+	"tired_face":                   "😫",
+	"tm":                           "™️",
+	"tongue":                       "👅",
+	"tophat":                       "🎩",
+	"triangular_flag_on_post":      "🚩",
+	"triumph":                      "😤",
+	"trophy":                       "🏆",
+	"tulip":                        "🌷",
+	"turtle":                       "🐢",
+	"tv":                           "📺",
+	"two":                          "2️⃣",
+	"two_hearts":                   "💕",
+	"uk":                           "🇬🇧",
+	"umbrella":                     "☔",
+	"unamused":                     "😒",
+	"unicorn_face":                 "🦄",
+	"unlock":                       "🔓",
+	"up":                           "🆙",
+	"upside_down_face":             "🙃",
+	"us":                           "🇺🇸",
+	"v":                            "✌️",
+	"video_game":                   "🎮",
+	"walking":                      "🚶",
+	"warning":                      "⚠️",
+	"wastebasket":                  "🗑️",
+	"watch":                        "⌚",
+	"wave":                         "👋",
+	"weary":                        "😩",
+	"whale":                        "🐳",
+	"white_check_mark":             "✅",
+	"white_circle":                 "⚪",
+	"white_flag":                   "🏳️",
+	"wine_glass":                   "🍷",
+	"wink":                         "😉",
+	"woman":                        "👩",
+	"woman-shrugging":              "🤷‍♀️",
+	"worried":                      "😟",
+	"wrench":                       "🔧",
+	"x":                            "❌",
+	"yawning_face":                 "🥱",
+	"yellow_heart":                 "💛",
+	"yum":                          "😋",
+	"zap":                          "⚡",
+	"zero":                         "0️⃣",
+	"zipper_mouth_face":            "🤐",
+	"zzz":                          "💤",
+}
@@ -0,0 +1,199 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/bpowers/slack"
+)
+
+// Emoji is /self/team/emoji/, the team's custom emoji.  Each emoji
+// is an image file named after its shortcode, and aliases are
+// symlinks to the emoji they stand for.
+type Emoji struct {
+	mu    sync.Mutex
+	dn    *DirNode
+	conn  *FSConn
+	names map[string]string // shortcode -> URL or "alias:$name"
+}
+
+func NewEmoji(parent *DirNode, conn *FSConn) (*Emoji, error) {
+	var err error
+	e := new(Emoji)
+	e.conn = conn
+	e.names = make(map[string]string)
+	e.dn, err = NewDirNode(parent, "emoji", e)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode(emoji): %s", err)
+	}
+	return e, nil
+}
+
+// Refresh fetches the team's emoji list, and rebuilds the directory
+// if anything has changed.
+func (e *Emoji) Refresh() error {
+	if e.conn.api == nil {
+		return nil
+	}
+
+	var resp struct {
+		Emoji map[string]string `json:"emoji"`
+	}
+	if err := e.conn.apiCall("emoji.list", nil, &resp); err != nil {
+		return fmt.Errorf("emoji.list: %s", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if sameEmoji(e.names, resp.Emoji) {
+		return nil
+	}
+	for name := range e.names {
+		e.dn.removeChild(emojiFileName(e.names, name))
+	}
+	// only remember the new list once the directory matches it,
+	// so that a failed rebuild is retried on the next refresh.
+	// build cleans up after itself, leaving the directory empty.
+	if err := e.build(resp.Emoji); err != nil {
+		e.names = make(map[string]string)
+		return err
+	}
+	e.names = resp.Emoji
+
+	return nil
+}
+
+// build adds a file for each emoji in names.  On error, any files it
+// added are removed again.
+//
+// must be called with e.mu held
+func (e *Emoji) build(names map[string]string) (err error) {
+	var added []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, fileName := range added {
+			e.dn.removeChild(fileName)
+		}
+	}()
+
+	// images first, so that aliases have something to point to.
+	files := make(map[string]INode)
+	for name, val := range names {
+		if strings.HasPrefix(val, "alias:") {
+			continue
+		}
+		n, err := e.newImage(emojiFileName(names, name), name, val)
+		if err != nil {
+			return fmt.Errorf("newImage(%s): %s", name, err)
+		}
+		n.Activate()
+		added = append(added, n.Name())
+		files[name] = n
+	}
+	for name, val := range names {
+		if !strings.HasPrefix(val, "alias:") {
+			continue
+		}
+		// aliases of standard emoji have nothing to point to.
+		target, ok := files[strings.TrimPrefix(val, "alias:")]
+		if !ok {
+			continue
+		}
+		s, err := NewSymlinkNode(e.dn, emojiFileName(names, name), target)
+		if err != nil {
+			return fmt.Errorf("NewSymlinkNode(%s): %s", name, err)
+		}
+		s.Activate()
+		added = append(added, s.Name())
+	}
+
+	return nil
+}
+
+func sameEmoji(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, val := range a {
+		if b[name] != val {
+			return false
+		}
+	}
+	return true
+}
+
+// emojiFileName is the name of the file for the given shortcode in
+// names, with the extension of the image (or of the image an alias
+// points to).
+func emojiFileName(names map[string]string, name string) string {
+	val := names[name]
+	if strings.HasPrefix(val, "alias:") {
+		val = names[strings.TrimPrefix(val, "alias:")]
+	}
+	ext := ".png"
+	if u, err := url.Parse(val); err == nil && path.Ext(u.Path) != "" {
+		ext = path.Ext(u.Path)
+	}
+	return name + ext
+}
+
+// must be called with e.mu held
+func (e *Emoji) newImage(fileName, name, imageURL string) (*remoteNode, error) {
+	urlFn := func() string {
+		return imageURL
+	}
+	cachePath := func(url string) string {
+		return e.conn.cacheFile("emoji", name, url, path.Ext(fileName))
+	}
+	return newRemoteNode(e.dn, fileName, urlFn, cachePath)
+}
+
+func (e *Emoji) Event(evt slack.SlackEvent) bool {
+	switch evt.Data.(type) {
+	case *slack.EmojiChangedEvent:
+		// emoji_changed may describe an add or one or more
+		// removals; simplest to refetch the whole list.
+		if err := e.Refresh(); err != nil {
+			log.Printf("Emoji.Refresh: %s", err)
+		}
+		return true
+	}
+	return false
+}
+
+func (e *Emoji) Activate() {
+	e.dn.Activate()
+	// fetch the list in the background, so as not to hold up
+	// mounting.
+	go func() {
+		if err := e.Refresh(); err != nil {
+			log.Printf("Emoji.Refresh: %s", err)
+		}
+	}()
+}
+
+var shortcodeRe = regexp.MustCompile(`:[a-z0-9_+'-]+:`)
+
+// emojify replaces the :shortcodes: of standard emoji in txt with
+// their Unicode equivalents.  Custom emoji (and anything else we
+// don't recognize) are left alone.
+func emojify(txt string) string {
+	return shortcodeRe.ReplaceAllStringFunc(txt, func(code string) string {
+		if r, ok := emojiCodes[strings.Trim(code, ":")]; ok {
+			return r
+		}
+		return code
+	})
+}
@@ -0,0 +1,34 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"testing"
+)
+
+func TestEmojify(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"no emoji here", "no emoji here"},
+		{":smile:", "😄"},
+		{"lgtm :+1:", "lgtm 👍"},
+		{":thumbsup::-1:", "👍👎"},
+		{"i :heart: go", "i ❤️ go"},
+		// custom and unknown emoji are left alone.
+		{":partyparrot:", ":partyparrot:"},
+		{":smile", ":smile"},
+		{"smile:", "smile:"},
+		{"::", "::"},
+		// shortcodes are lowercase.
+		{":SMILE:", ":SMILE:"},
+		{"at 10:30:45 :smile:", "at 10:30:45 😄"},
+	} {
+		if out := emojify(tc.in); out != tc.out {
+			t.Errorf("emojify(%q) = %q, want %q", tc.in, out, tc.out)
+		}
+	}
+}
@@ -167,6 +167,18 @@ func (an *AttrNode) Activate() error {
 	return an.parent.addChild(an)
 }
 
+// DirMaker is implemented by objects that back directories
+// supporting mkdir of their children.
+type DirMaker interface {
+	Mkdir(name string) (INode, error)
+}
+
+// Rmdirer is implemented by DirMakers that also support removing
+// their child directories.
+type Rmdirer interface {
+	Rmdir(name string) error
+}
+
 type DirNode struct {
 	Node
 
@@ -175,15 +187,95 @@ type DirNode struct {
 
 	childmap map[string]INode
 	children []INode
+
+	maker DirMaker // nil if mkdir is unsupported
+}
+
+// SetMaker makes dn writable, delegating mkdir and rmdir to m.
+func (dn *DirNode) SetMaker(m DirMaker) {
+	dn.maker = m
+	dn.mode = os.ModeDir | 0755
+}
+
+func (dn *DirNode) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	if dn.maker == nil {
+		return nil, fuse.EPERM
+	}
+	return dn.maker.Mkdir(req.Name)
+}
+
+// Symlinker is implemented by DirMakers that also support creating
+// symlinks.
+type Symlinker interface {
+	Symlink(name, target string) (INode, error)
+}
+
+func (dn *DirNode) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, error) {
+	s, ok := dn.maker.(Symlinker)
+	if !ok {
+		return nil, fuse.EPERM
+	}
+	return s.Symlink(req.NewName, req.Target)
+}
+
+// Unlinker is implemented by nodes that support unlink(2).
+type Unlinker interface {
+	Unlink() error
+}
+
+func (dn *DirNode) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	if req.Dir {
+		r, ok := dn.maker.(Rmdirer)
+		if !ok {
+			return fuse.EPERM
+		}
+		return r.Rmdir(req.Name)
+	}
+
+	dn.mu.Lock()
+	child, ok := dn.childmap[req.Name]
+	dn.mu.Unlock()
+	if !ok {
+		return fuse.ENOENT
+	}
+	if u, ok := child.(Unlinker); ok {
+		return u.Unlink()
+	}
+	// in particular, unlinking a by-name symlink doesn't archive
+	// or leave its room: 'rm -r' is too easy to run by mistake.
+	return fuse.EPERM
 }
 
 func (dn *DirNode) addChild(child INode) error {
+	dn.mu.Lock()
+	defer dn.mu.Unlock()
+
 	dn.childmap[child.Name()] = child
 	dn.children = append(dn.children, child)
 	return nil
 }
 
+func (dn *DirNode) removeChild(name string) {
+	dn.mu.Lock()
+	defer dn.mu.Unlock()
+
+	child, ok := dn.childmap[name]
+	if !ok {
+		return
+	}
+	delete(dn.childmap, name)
+	for i, n := range dn.children {
+		if n == child {
+			dn.children = append(dn.children[:i], dn.children[i+1:]...)
+			break
+		}
+	}
+}
+
 func (dn *DirNode) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	dn.mu.Lock()
+	defer dn.mu.Unlock()
+
 	if n, ok := dn.childmap[name]; ok {
 		return n, nil
 	} else {
@@ -195,6 +287,9 @@ func (dn *DirNode) Attr(a *fuse.Attr) {
 	a.Inode = dn.ino
 	a.Mode = dn.mode
 
+	dn.mu.Lock()
+	defer dn.mu.Unlock()
+
 	// linkcount for dirs is 2 + n subdirs
 	a.Nlink = 2
 	for _, n := range dn.children {
@@ -204,7 +299,25 @@ func (dn *DirNode) Attr(a *fuse.Attr) {
 	}
 }
 
+// UpdateChildren calls Update on every child attribute, for use
+// after the object backing dn has changed.
+func (dn *DirNode) UpdateChildren() {
+	dn.mu.Lock()
+	children := make([]INode, len(dn.children))
+	copy(children, dn.children)
+	dn.mu.Unlock()
+
+	for _, child := range children {
+		if up, ok := child.(Updater); ok {
+			up.Update()
+		}
+	}
+}
+
 func (dn *DirNode) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	dn.mu.Lock()
+	defer dn.mu.Unlock()
+
 	dents := make([]fuse.Dirent, 0, len(dn.children))
 	for _, child := range dn.children {
 		dents = append(dents, child.Dirent())
@@ -283,17 +396,26 @@ func NewSuper() *Super {
 	return super
 }
 
-func NewDirNode(parent *DirNode, name string, priv interface{}) (*DirNode, error) {
-	dn := new(DirNode)
+// Init is for types embedding DirNode; everyone else should use
+// NewDirNode.
+func (dn *DirNode) Init(parent *DirNode, name string, priv interface{}) error {
 	err := dn.Node.Init(parent, name, priv)
 	if err != nil {
-		return nil, fmt.Errorf("n.Init('%s', %#v): %s", name, priv, err)
+		return fmt.Errorf("n.Init('%s', %#v): %s", name, priv, err)
 	}
 	dn.childmap = make(map[string]INode)
 	dn.children = make([]INode, 0)
 
 	dn.mode = os.ModeDir | 0555
 
+	return nil
+}
+
+func NewDirNode(parent *DirNode, name string, priv interface{}) (*DirNode, error) {
+	dn := new(DirNode)
+	if err := dn.Init(parent, name, priv); err != nil {
+		return nil, err
+	}
 	return dn, nil
 }
 
@@ -11,8 +11,10 @@ import (
 	"log"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/bpowers/fuse"
 	"github.com/bpowers/slack"
 )
 
@@ -26,29 +28,101 @@ type Room interface {
 	Name() string
 	IsOpen() bool
 	BaseChannel() *slack.BaseChannel
-	//Open()  // maybe?
-	//Close() // maybe?
+	Start()
+	Stop()
+}
+
+// Options control optional FSConn behavior.  The zero value is
+// valid, and disables everything optional.
+type Options struct {
+	// CacheDir, if non-empty, is where room history is
+	// persisted between mounts (see DefaultCacheDir).
+	CacheDir string
+
+	// SessionWindow, if non-zero, is the maximum number of bytes
+	// of each room's formatted session kept in memory.  Older
+	// output is moved to a file in SpillDir (or the system
+	// temporary directory, if SpillDir is empty), and the
+	// messages it held are dropped from messages/.
+	SessionWindow int
+	SpillDir      string
+
+	// History, if non-zero, is the number of messages fetched
+	// for each room when we start (at most 1000).  Otherwise we
+	// fetch the unread messages plus a hundred.
+	History int
+
+	// AllowRmdir confirms that removing a directory in
+	// channels/by-id or groups/by-id should archive the channel or
+	// leave the group.  Without it, those removals fail with
+	// EPERM.  The by-name symlinks can't be removed either way.
+	AllowRmdir bool
+
+	// The options below can be changed with FSConn.Reload.
+
+	// Location is the timezone timestamps are displayed in.  If
+	// nil, the machine's local timezone is used.
+	Location *time.Location
+
+	// Templates format messages in room sessions.
+	Templates Templates
+
+	// Ignore lists users (by name or ID) whose messages are left
+	// out of room sessions.
+	Ignore []string
+
+	// Highlight lists keywords the 'highlight' template function
+	// marks up in message text.
+	Highlight []string
+}
+
+// Templates are the text/template sources used to format messages
+// in room sessions.  Empty fields use the defaults.
+type Templates struct {
+	Msg     string
+	Edited  string
+	Deleted string
 }
 
 type FSConn struct {
-	Super *Super
+	Super  *Super
+	optsMu sync.Mutex // protects the reloadable parts of opts
+	opts   Options
+	root   *DirNode // our top-level directory
 
-	api *slack.Slack
-	ws  *slack.SlackWS
-	in  chan slack.SlackEvent
+	api   *slack.Slack
+	token string // for Web API methods the slack package lacks
+	wsMu  sync.Mutex
+	ws    *slack.SlackWS // replaced on reconnect; see websocket
+	in    chan slack.SlackEvent
+
+	closeOnce sync.Once
+	done      chan struct{} // closed by Close
 
 	sinks    []EventHandler
 	users    *UserSet
 	channels *RoomSet
 	groups   *RoomSet
 	ims      *RoomSet
+	mpims    *RoomSet
+	all      *AllChannels
 	self     *Self
+	team     *Team
+	emoji    *Emoji
+	search   *Search
 }
 
-// shared by offline/offline public New functions
-func newFSConn(token, infoPath string) (conn *FSConn, err error) {
+// shared by offline/offline public New functions.  If parent is nil,
+// the connection gets a Super of its own, and lives at its root.
+// Otherwise it lives in a directory under parent named after the
+// team's ID, which the caller must Activate.
+func newFSConn(token, infoPath string, opts *Options, super *Super, parent *DirNode) (conn *FSConn, err error) {
 	var info slack.Info
+	var rtm rtmTeam
 	conn = new(FSConn)
+	if opts != nil {
+		conn.opts = *opts
+	}
 
 	if infoPath != "" {
 		buf, err := ioutil.ReadFile(infoPath)
@@ -59,8 +133,14 @@ func newFSConn(token, infoPath string) (conn *FSConn, err error) {
 		if err != nil {
 			return nil, fmt.Errorf("Unmarshal: %s", err)
 		}
+		err = json.Unmarshal(buf, &rtm)
+		if err != nil {
+			return nil, fmt.Errorf("Unmarshal: %s", err)
+		}
 	} else {
+		RedactToken(token)
 		conn.api = slack.New(token)
+		conn.token = token
 		//conn.api.SetDebug(true)
 		conn.ws, err = conn.api.StartRTM("", "https://slack.com")
 		if err != nil {
@@ -70,8 +150,18 @@ func newFSConn(token, infoPath string) (conn *FSConn, err error) {
 	}
 
 	conn.in = make(chan slack.SlackEvent)
+	conn.done = make(chan struct{})
 	conn.sinks = make([]EventHandler, 0, 5)
-	conn.Super = NewSuper()
+	if parent == nil {
+		conn.Super = NewSuper()
+		conn.root = conn.Super.root
+	} else {
+		conn.Super = super
+		conn.root, err = NewDirNode(parent, info.Team.Id, conn)
+		if err != nil {
+			return nil, fmt.Errorf("NewDirNode(%s): %s", info.Team.Id, err)
+		}
+	}
 
 	users := make([]*User, 0, len(info.Users))
 	for _, u := range info.Users {
@@ -86,6 +176,13 @@ func newFSConn(token, infoPath string) (conn *FSConn, err error) {
 	if err != nil {
 		return nil, fmt.Errorf("NewSelf: %s", err)
 	}
+	if infoPath != "" {
+		conn.team.mu.Lock()
+		conn.team.Plan = rtm.Team.Plan
+		conn.team.Prefs = rtm.Team.Prefs
+		conn.team.mu.Unlock()
+		conn.team.dir.UpdateChildren()
+	}
 
 	chans := make([]Room, 0, len(info.Channels))
 	for _, c := range info.Channels {
@@ -96,8 +193,18 @@ func newFSConn(token, infoPath string) (conn *FSConn, err error) {
 		return nil, fmt.Errorf("NewRoomSet: %s", err)
 	}
 
+	conn.all, err = NewAllChannels(conn, chans)
+	if err != nil {
+		return nil, fmt.Errorf("NewAllChannels: %s", err)
+	}
+
 	groups := make([]Room, 0, len(info.Groups))
 	for _, g := range info.Groups {
+		// older clients get MPIMs as groups too; they
+		// live in mpims/ instead.
+		if g.IsMpIM {
+			continue
+		}
 		groups = append(groups, NewGroup(g, conn))
 	}
 	conn.groups, err = NewRoomSet("groups", conn, NewGroupDir, groups)
@@ -114,29 +221,194 @@ func newFSConn(token, infoPath string) (conn *FSConn, err error) {
 		return nil, fmt.Errorf("NewRoomSet: %s", err)
 	}
 
+	mpims := make([]Room, 0, len(info.MPIMs))
+	for _, m := range info.MPIMs {
+		mpims = append(mpims, NewMPIM(m, conn))
+	}
+	conn.mpims, err = NewRoomSet("mpims", conn, NewMPIMDir, mpims)
+	if err != nil {
+		return nil, fmt.Errorf("NewRoomSet: %s", err)
+	}
+
+	conn.channels.ds.byName.SetMaker(&roomMaker{conn.channels, conn.createChannel})
+	conn.groups.ds.byName.SetMaker(&roomMaker{conn.groups, conn.createGroup})
+	conn.ims.ds.byName.SetMaker(&imMaker{conn.ims})
+	conn.channels.ds.byId.SetMaker(&roomIdMaker{conn.channels, "archive", true})
+	conn.groups.ds.byId.SetMaker(&roomIdMaker{conn.groups, "leave", true})
+	conn.ims.ds.byId.SetMaker(&roomIdMaker{conn.ims, "close", false})
+	conn.mpims.ds.byId.SetMaker(&roomIdMaker{conn.mpims, "close", false})
+	for _, room := range ims {
+		im := room.(*IM)
+		if dir := conn.ims.ds.LookupId(im.Id()); dir != nil {
+			conn.users.LinkIM(im.UserId, dir)
+		}
+	}
+
+	conn.search, err = NewSearch(conn)
+	if err != nil {
+		return nil, fmt.Errorf("NewSearch: %s", err)
+	}
+
 	// simplify dispatch code by keeping track of event handlers
 	// in a slice.  We (FSConn) are an event sink too - add
 	// ourselves to the list first, so that we can separate
 	// routing logic from connection-level handling logic.
 	conn.sinks = append(conn.sinks, conn,
-		conn.users, conn.channels, conn.groups, conn.ims)
+		conn.users, conn.channels, conn.groups, conn.ims, conn.mpims,
+		conn.team, conn.emoji)
 
 	// only spawn goroutines in online mode
 	if infoPath == "" {
-		go conn.ws.HandleIncomingEvents(conn.in)
-		go conn.ws.Keepalive(10 * time.Second)
+		go conn.run()
 		go conn.consumeEvents()
 	}
 
 	return conn, nil
 }
 
-func NewFSConn(token string) (*FSConn, error) {
-	return newFSConn(token, "")
+func NewFSConn(token string, opts *Options) (*FSConn, error) {
+	return newFSConn(token, "", opts, nil, nil)
+}
+
+func NewOfflineFSConn(infoPath string, opts *Options) (*FSConn, error) {
+	return newFSConn("", infoPath, opts, nil, nil)
+}
+
+// Close shuts the connection down: events are no longer routed into
+// the filesystem, we stop reconnecting, and every room's session
+// releases its spill and cache files.  The slack package has no way
+// to close the websocket itself, so it is left idle until the server
+// drops it.
+func (conn *FSConn) Close() {
+	conn.closeOnce.Do(func() {
+		close(conn.done)
+	})
+	for _, rs := range []*RoomSet{conn.channels, conn.groups, conn.ims, conn.mpims} {
+		rs.Lock()
+		for _, room := range rs.objs {
+			room.Stop()
+		}
+		rs.Unlock()
+	}
+}
+
+// Reload replaces the options that can be changed while mounted:
+// Location, Templates, Ignore and Highlight.  The rest of opts is
+// ignored.  The changes apply to messages formatted from now on.
+func (conn *FSConn) Reload(opts *Options) {
+	conn.optsMu.Lock()
+	defer conn.optsMu.Unlock()
+
+	conn.opts.Location = opts.Location
+	conn.opts.Templates = opts.Templates
+	conn.opts.Ignore = opts.Ignore
+	conn.opts.Highlight = opts.Highlight
+}
+
+// templates returns the message templates, with defaults filled in.
+func (conn *FSConn) templates() Templates {
+	conn.optsMu.Lock()
+	t := conn.opts.Templates
+	conn.optsMu.Unlock()
+
+	if t.Msg == "" {
+		t.Msg = defaultMsgTmpl
+	}
+	if t.Edited == "" {
+		t.Edited = editedMsgTmpl
+	}
+	if t.Deleted == "" {
+		t.Deleted = deletedMsgTmpl
+	}
+	return t
+}
+
+// ignored returns true if the user's messages shouldn't appear in
+// sessions.
+func (conn *FSConn) ignored(userId string) bool {
+	conn.optsMu.Lock()
+	ignore := conn.opts.Ignore
+	conn.optsMu.Unlock()
+
+	if len(ignore) == 0 {
+		return false
+	}
+	name := userId
+	if u := conn.users.Get(userId); u != nil {
+		name = u.name()
+	}
+	for _, who := range ignore {
+		if who == userId || who == name {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight wraps each occurrence of a highlighted keyword in txt in
+// terminal reverse-video escapes.  Matching ignores case.
+func (conn *FSConn) highlight(txt string) string {
+	conn.optsMu.Lock()
+	keywords := conn.opts.Highlight
+	conn.optsMu.Unlock()
+
+	for _, kw := range keywords {
+		if kw == "" {
+			continue
+		}
+		var out []string
+		lower, lowerKw := strings.ToLower(txt), strings.ToLower(kw)
+		if len(lower) != len(txt) || len(lowerKw) != len(kw) {
+			// lowercasing changed byte offsets, so fall
+			// back to an exact match.
+			lower, lowerKw = txt, kw
+		}
+		for {
+			i := strings.Index(lower, lowerKw)
+			if i < 0 {
+				break
+			}
+			j := i + len(kw)
+			out = append(out, txt[:i], "\x1b[7m", txt[i:j], "\x1b[27m")
+			txt, lower = txt[j:], lower[j:]
+		}
+		txt = strings.Join(append(out, txt), "")
+	}
+	return txt
+}
+
+// Domain returns the team's domain, e.g. 'example' for
+// example.slack.com.
+func (conn *FSConn) Domain() string {
+	conn.team.mu.Lock()
+	defer conn.team.mu.Unlock()
+
+	return conn.team.Domain
+}
+
+// roomDir returns the by-id directory for the channel, group, IM or MPIM
+// with the given ID, or nil if it isn't open.
+func (conn *FSConn) roomDir(id string) *DirNode {
+	for _, rs := range []*RoomSet{conn.channels, conn.groups, conn.ims, conn.mpims} {
+		rs.Lock()
+		dir := rs.ds.LookupId(id)
+		rs.Unlock()
+		if dir != nil {
+			return dir
+		}
+	}
+	return nil
 }
 
-func NewOfflineFSConn(infoPath string) (*FSConn, error) {
-	return newFSConn("", infoPath)
+// permalink returns the web URL for the message with timestamp ts
+// in the given room.
+func (conn *FSConn) permalink(roomId, ts string) string {
+	conn.team.mu.Lock()
+	domain := conn.team.Domain
+	conn.team.mu.Unlock()
+
+	return fmt.Sprintf("https://%s.slack.com/archives/%s/p%s",
+		domain, roomId, strings.Replace(ts, ".", "", 1))
 }
 
 func (conn *FSConn) Event(evt slack.SlackEvent) bool {
@@ -148,10 +420,104 @@ func (conn *FSConn) Event(evt slack.SlackEvent) bool {
 	return false
 }
 
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 5 * time.Minute
+)
+
+// websocket returns the current RTM connection.
+func (conn *FSConn) websocket() *slack.SlackWS {
+	conn.wsMu.Lock()
+	defer conn.wsMu.Unlock()
+
+	return conn.ws
+}
+
+// retryWithBackoff calls try until it succeeds, waiting twice as long
+// after each failure, up to maxReconnectDelay.  It returns false if
+// done is closed first.
+func retryWithBackoff(done <-chan struct{}, name string, try func() error) bool {
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-done:
+			return false
+		default:
+		}
+		log.Printf("%s: reconnecting in %s", name, delay)
+		select {
+		case <-time.After(delay):
+		case <-done:
+			return false
+		}
+
+		err := try()
+		if err == nil {
+			return true
+		}
+		log.Printf("%s: %s", name, err)
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// run feeds events from the RTM websocket to conn.in, reconnecting
+// whenever the connection fails.  Failures (the slack package
+// panics on read errors) are contained here, so that when serving
+// several teams one bad connection doesn't take down the others.
+func (conn *FSConn) run() {
+	for {
+		ws := conn.websocket()
+		go conn.keepalive(ws)
+		conn.readEvents(ws)
+
+		ok := retryWithBackoff(conn.done, conn.Domain(), func() error {
+			ws, err := conn.api.StartRTM("", "https://slack.com")
+			if err != nil {
+				return fmt.Errorf("StartRTM: %s", err)
+			}
+			conn.wsMu.Lock()
+			conn.ws = ws
+			conn.wsMu.Unlock()
+			return nil
+		})
+		if !ok {
+			return
+		}
+		// TODO: fetch history we missed while disconnected
+	}
+}
+
+func (conn *FSConn) readEvents(ws *slack.SlackWS) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s: websocket: %v", conn.Domain(), r)
+		}
+	}()
+	ws.HandleIncomingEvents(conn.in)
+}
+
+func (conn *FSConn) keepalive(ws *slack.SlackWS) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s: keepalive: %v", conn.Domain(), r)
+		}
+	}()
+	ws.Keepalive(10 * time.Second)
+}
+
 func (conn *FSConn) consumeEvents() {
 	for {
-		evt := <-conn.in
-		go conn.routeEvent(evt)
+		select {
+		case evt := <-conn.in:
+			go conn.routeEvent(evt)
+		case <-conn.done:
+			// once closed, stop reading, which in turn
+			// stops the slack package reading from the
+			// websocket.
+			return
+		}
 	}
 }
 
@@ -163,15 +529,16 @@ func (conn *FSConn) routeEvent(evt slack.SlackEvent) {
 		}
 	}
 	if !ok {
-		fmt.Printf("unhandled evt: %#v\n", evt)
+		log.Printf("unhandled evt: %#v", evt)
 	}
 }
 
 func (fs *FSConn) Send(txtBytes []byte, id string) error {
 	txt := strings.TrimSpace(string(txtBytes))
 
-	out := fs.ws.NewOutgoingMessage(txt, id)
-	err := fs.ws.SendMessage(out)
+	ws := fs.websocket()
+	out := ws.NewOutgoingMessage(txt, id)
+	err := ws.SendMessage(out)
 	if err != nil {
 		log.Printf("SendMessage: %s", err)
 	}
@@ -181,25 +548,42 @@ func (fs *FSConn) Send(txtBytes []byte, id string) error {
 }
 
 type Self struct {
+	conn *FSConn
 	dn   *DirNode
 	team *DirNode
 	user *SymlinkNode
+
+	userId string
 }
 
 func NewSelf(conn *FSConn, user *slack.UserDetails, team *slack.Team) (*Self, error) {
 	var err error
 	self := new(Self)
+	self.conn = conn
+	self.userId = user.Id
 
-	self.dn, err = NewDirNode(conn.Super.root, "self", conn)
+	self.dn, err = NewDirNode(conn.root, "self", conn)
 	if err != nil {
 		return nil, fmt.Errorf("NewDirNode(self): %s", err)
 	}
-	self.team, err = NewTeamDir(self.dn, "team", NewTeam(team, conn))
+	conn.team = NewTeam(team, conn)
+	self.team, err = NewTeamDir(self.dn, "team", conn.team)
 	if err != nil {
 		return nil, fmt.Errorf("NewTeamDir(): %s", err)
 	}
+	// fill in the team details rtm.start doesn't give us in
+	// the background, so as not to hold up mounting.
+	go func() {
+		if err := conn.team.Refresh(); err != nil {
+			log.Printf("Team.Refresh: %s", err)
+		}
+	}()
+	conn.emoji, err = NewEmoji(self.team, conn)
+	if err != nil {
+		return nil, fmt.Errorf("NewEmoji(): %s", err)
+	}
 
-	userDir := conn.users.ds.LookupId(user.Id)
+	userDir := conn.users.Dir(user.Id)
 	if userDir == nil {
 		// this is an invariant, can't continue if we don't
 		// know who we are.
@@ -210,7 +594,12 @@ func NewSelf(conn *FSConn, user *slack.UserDetails, team *slack.Team) (*Self, er
 		return nil, fmt.Errorf("NewSymlinkNode(self/user): %s", err)
 	}
 
+	if err = newSelfAttrs(self); err != nil {
+		return nil, fmt.Errorf("newSelfAttrs: %s", err)
+	}
+
 	self.user.Activate()
+	conn.emoji.Activate()
 	self.team.Activate()
 	self.dn.Activate()
 
@@ -229,7 +618,7 @@ func NewUserSet(name string, conn *FSConn, create DirCreator, users []*User) (*U
 	us := new(UserSet)
 	us.conn = conn
 	us.objs = make(map[string]*User)
-	us.ds, err = NewDirSet(conn.Super.root, name, create, conn)
+	us.ds, err = NewDirSet(conn.root, name, create, conn)
 	if err != nil {
 		return nil, fmt.Errorf("NewDirSet('groups'): %s", err)
 	}
@@ -257,9 +646,58 @@ func (us *UserSet) Get(id string) *User {
 	return us.objs[id]
 }
 
-// on change, lock UserSet, then lock User.  No need to lock DirNode,
-// as it doesn't change (we're not adding/removing child attributes).
-// Updates to Attributes are done through atomic ops.
+// Dir returns the directory for the user with the given ID, or nil
+// if they have none.  DirSet's maps change on user_change events, so
+// callers outside of UserSet must go through here.
+func (us *UserSet) Dir(id string) *DirNode {
+	us.Lock()
+	defer us.Unlock()
+
+	return us.ds.LookupId(id)
+}
+
+// Lookup finds a user by either ID or username.
+func (us *UserSet) Lookup(nameOrId string) *User {
+	us.Lock()
+	defer us.Unlock()
+
+	if u, ok := us.objs[nameOrId]; ok {
+		return u
+	}
+	for _, u := range us.objs {
+		if u.name() == nameOrId && !u.deleted() {
+			return u
+		}
+	}
+	return nil
+}
+
+// LinkIM points the 'im' symlink in a user's directory at dir, or
+// removes it if dir is nil.
+func (us *UserSet) LinkIM(userId string, dir *DirNode) {
+	us.Lock()
+	defer us.Unlock()
+
+	ud := us.ds.LookupId(userId)
+	if ud == nil {
+		return
+	}
+	ud.removeChild("im")
+	if dir == nil {
+		return
+	}
+	s, err := NewSymlinkNode(ud, "im", dir)
+	if err != nil {
+		log.Printf("NewSymlinkNode(%s/im): %s", userId, err)
+		return
+	}
+	s.Activate()
+}
+
+// on change, lock UserSet, then lock User.  User directories gain and
+// lose their 'im' symlink (see LinkIM), so their children are looked
+// up under the DirNode's lock.  Updates to Attributes are done
+// through atomic ops.
 func (us *UserSet) Event(evt slack.SlackEvent) bool {
 	switch msg := evt.Data.(type) {
 	case *slack.ManualPresenceChangeEvent:
@@ -278,7 +716,7 @@ func (us *UserSet) Event(evt slack.SlackEvent) bool {
 			return true
 		}
 
-		log.Printf("Presence Change: %s -> %s", user.Name, msg.Presence)
+		log.Printf("Presence Change: %s -> %s", user.name(), msg.Presence)
 
 		ud := us.ds.LookupId(msg.UserId)
 		if ud == nil {
@@ -287,20 +725,97 @@ func (us *UserSet) Event(evt slack.SlackEvent) bool {
 		}
 
 		user.mu.Lock()
-		defer user.mu.Unlock()
-
 		user.Presence = msg.Presence
-		for _, child := range ud.children {
-			if up, ok := child.(Updater); ok && child.Name() == "presence" {
-				up.Update()
-			}
+		user.mu.Unlock()
+
+		ud.mu.Lock()
+		child := ud.childmap["presence"]
+		ud.mu.Unlock()
+		if up, ok := child.(Updater); ok {
+			up.Update()
 		}
 
+		return true
+	case *slack.UserChangeEvent:
+		// rooms' names and members/ entries are looked up
+		// through the UserSet, so follow a rename after
+		// unlocking it.
+		if us.change(&msg.User) {
+			us.conn.userRenamed(msg.User.Id)
+		}
 		return true
 	}
 	return false
 }
 
+// change applies a user_change event, returning true if the user
+// was renamed.
+func (us *UserSet) change(su *slack.User) bool {
+	us.Lock()
+	defer us.Unlock()
+
+	user, ok := us.objs[su.Id]
+	if !ok {
+		log.Printf("XXX: user change with no user object: %s", su.Id)
+		return false
+	}
+
+	user.mu.Lock()
+	oldName := user.Name
+	user.update(su)
+	name, deleted := user.Name, user.Deleted
+	user.mu.Unlock()
+
+	ud := us.ds.LookupId(user.Id)
+	switch {
+	case ud == nil && !deleted:
+		if err := us.ds.Insert(user.Id, name, user); err != nil {
+			log.Printf("Insert(%s): %s", user.Id, err)
+		}
+	case ud != nil && deleted:
+		if err := us.ds.Remove(user.Id); err != nil {
+			log.Printf("Remove(%s): %s", user.Id, err)
+		}
+	case ud != nil:
+		if err := us.ds.Rename(user.Id, name); err != nil {
+			log.Printf("Rename(%s): %s", user.Id, err)
+		}
+		ud.UpdateChildren()
+		return name != oldName
+	}
+	return false
+}
+
+// userRenamed follows a change to a user's name everywhere they are
+// linked to by name: rooms' members/ directories, and the by-name
+// entries of their IMs and MPIMs.
+func (conn *FSConn) userRenamed(userId string) {
+	for _, rs := range []*RoomSet{conn.channels, conn.groups, conn.ims, conn.mpims} {
+		for _, r := range rs.rooms() {
+			var md *MemberDir
+			switch r := r.(type) {
+			case *Channel:
+				md = r.members
+			case *Group:
+				md = r.members
+			case *MPIM:
+				md = r.members
+			case *IM:
+				if r.UserId == userId {
+					rs.rename(r)
+				}
+			}
+			if md == nil || !md.Rename(userId) {
+				continue
+			}
+			// MPIMs are named after their members.
+			if _, ok := r.(*MPIM); ok {
+				rs.rename(r)
+			}
+		}
+	}
+}
+
 type RoomSet struct {
 	sync.Mutex
 	name string
@@ -315,7 +830,7 @@ func NewRoomSet(name string, conn *FSConn, create DirCreator, rooms []Room) (*Ro
 	rs.name = name
 	rs.conn = conn
 	rs.objs = make(map[string]Room)
-	rs.ds, err = NewDirSet(conn.Super.root, name, create, conn)
+	rs.ds, err = NewDirSet(conn.root, name, create, conn)
 	if err != nil {
 		return nil, fmt.Errorf("NewDirSet('%s'): %s", name, err)
 	}
@@ -339,37 +854,297 @@ func NewRoomSet(name string, conn *FSConn, create DirCreator, rooms []Room) (*Ro
 	return rs, nil
 }
 
+// Show makes an already-known room visible in the filesystem, if it
+// isn't already.
+func (rs *RoomSet) Show(room Room) error {
+	rs.Lock()
+	defer rs.Unlock()
+
+	rs.objs[room.Id()] = room
+	if rs.ds.LookupId(room.Id()) != nil {
+		return nil
+	}
+	if err := rs.ds.Insert(room.Id(), room.Name(), room); err != nil {
+		return err
+	}
+	room.Start()
+	return nil
+}
+
+// Hide removes a room's directory from the filesystem.  We keep
+// the Room object around in case it is reopened, but stop its
+// Session, releasing its history until then.
+func (rs *RoomSet) Hide(id string) error {
+	rs.Lock()
+	defer rs.Unlock()
+
+	if rs.ds.LookupId(id) == nil {
+		return nil
+	}
+	if err := rs.ds.Remove(id); err != nil {
+		return err
+	}
+	if room, ok := rs.objs[id]; ok {
+		room.Stop()
+	}
+	return nil
+}
+
+// roomMaker creates rooms with mkdir in a RoomSet's by-name
+// directory.  Entries there are symlinks, and the kernel fails rmdir
+// of a symlink with ENOTDIR without asking us, so archiving and
+// leaving happen by removing the by-id directory instead (see
+// roomIdMaker).
+type roomMaker struct {
+	rs     *RoomSet
+	create func(name string) (Room, error)
+}
+
+func (m *roomMaker) Mkdir(name string) (INode, error) {
+	conn := m.rs.conn
+	if conn.api == nil {
+		return nil, fuse.ENOSYS
+	}
+
+	m.rs.Lock()
+	_, exists := m.rs.ds.objSyms[name]
+	m.rs.Unlock()
+	if exists {
+		return nil, fuse.Errno(syscall.EEXIST)
+	}
+
+	room, err := m.create(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.rs.Show(room); err != nil {
+		log.Printf("Show(%s): %s", room.Id(), err)
+		return nil, fuse.EIO
+	}
+
+	// as with imMaker, the new entry is a symlink, which we
+	// can't return from mkdir, so return its target.
+	m.rs.Lock()
+	dir := m.rs.ds.LookupId(room.Id())
+	m.rs.Unlock()
+	if dir == nil {
+		return nil, fuse.EIO
+	}
+	return dir, nil
+}
+
+// Symlink joins the room with the given name, for
+// 'ln -s ../all/$name channels/by-name/'.
+func (m *roomMaker) Symlink(name, target string) (INode, error) {
+	m.rs.Lock()
+	var room Room
+	for _, r := range m.rs.objs {
+		if r.Name() == name {
+			room = r
+			break
+		}
+	}
+	m.rs.Unlock()
+
+	ctl, ok := room.(Controller)
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	if err := ctl.Ctl("join", ""); err != nil {
+		return nil, err
+	}
+
+	m.rs.Lock()
+	defer m.rs.Unlock()
+	s, ok := m.rs.ds.objSyms[name]
+	if !ok {
+		return nil, fuse.EIO
+	}
+	return s, nil
+}
+
+// roomIdMaker runs rmCmd through a room's Ctl when its by-id
+// directory is removed.  Archiving a channel or leaving a group
+// can't easily be undone, so if confirm is set it also needs
+// AllowRmdir.
+type roomIdMaker struct {
+	rs      *RoomSet
+	rmCmd   string
+	confirm bool
+}
+
+func (m *roomIdMaker) Mkdir(name string) (INode, error) {
+	return nil, fuse.EPERM
+}
+
+func (m *roomIdMaker) Rmdir(id string) error {
+	if m.confirm && !m.rs.conn.opts.AllowRmdir {
+		return fuse.EPERM
+	}
+
+	m.rs.Lock()
+	room := m.rs.objs[id]
+	m.rs.Unlock()
+
+	ctl, ok := room.(Controller)
+	if !ok {
+		return fuse.ENOENT
+	}
+	return ctl.Ctl(m.rmCmd, "")
+}
+
+// opener is implemented by rooms whose open (or for channels,
+// member) state can be changed by events.
+type opener interface {
+	setOpen(open bool)
+}
+
+// Open shows a room that was opened elsewhere, e.g. by another
+// client.
 func (rs *RoomSet) Open(evt *slack.ChannelInfoEvent) bool {
-	fmt.Printf("opening %#v", evt)
+	rs.Lock()
+	room, ok := rs.objs[evt.ChannelId]
+	rs.Unlock()
+	if !ok {
+		log.Printf("%s: open of unknown room %s", rs.name, evt.ChannelId)
+		return false
+	}
+	if o, ok := room.(opener); ok {
+		o.setOpen(true)
+	}
+	if err := rs.Show(room); err != nil {
+		log.Printf("Show(%s): %s", room.Id(), err)
+		return true
+	}
+	if im, ok := room.(*IM); ok {
+		rs.conn.users.LinkIM(im.UserId, rs.conn.roomDir(im.Id()))
+	}
+	return true
+}
 
+// Close hides a room that was closed elsewhere.
+func (rs *RoomSet) Close(evt *slack.ChannelInfoEvent) bool {
+	rs.Lock()
+	room, ok := rs.objs[evt.ChannelId]
+	rs.Unlock()
+	if !ok {
+		return false
+	}
+	if o, ok := room.(opener); ok {
+		o.setOpen(false)
+	}
+	if im, ok := room.(*IM); ok {
+		rs.conn.users.LinkIM(im.UserId, nil)
+	}
+	if err := rs.Hide(room.Id()); err != nil {
+		log.Printf("Hide(%s): %s", room.Id(), err)
+	}
 	return true
 }
 
 func (rs *RoomSet) Event(evt slack.SlackEvent) bool {
-	rs.Lock()
-	defer rs.Unlock()
+	// Open and Close go through Show and Hide, which take rs's
+	// lock themselves, so handle them before locking.
+	switch msg := evt.Data.(type) {
+	case *slack.IMOpenEvent:
+		return rs.name == "ims" && rs.Open((*slack.ChannelInfoEvent)(msg))
+	case *slack.GroupOpenEvent:
+		return rs.name == "groups" && rs.Open((*slack.ChannelInfoEvent)(msg))
+	case *slack.MPIMOpenEvent:
+		return rs.name == "mpims" && rs.Open((*slack.ChannelInfoEvent)(msg))
+	case *slack.IMCloseEvent:
+		return rs.name == "ims" && rs.Close((*slack.ChannelInfoEvent)(msg))
+	case *slack.GroupCloseEvent:
+		return rs.name == "groups" && rs.Close((*slack.ChannelInfoEvent)(msg))
+	case *slack.MPIMCloseEvent:
+		return rs.name == "mpims" && rs.Close((*slack.ChannelInfoEvent)(msg))
+	}
+
+	// rooms' Event methods may take a while (fetching history on
+	// an ack, say), so look rooms up under rs's lock but call
+	// them without it.
 	switch msg := evt.Data.(type) {
 	case slack.AckMessage:
-		for _, room := range rs.objs {
+		for _, room := range rs.rooms() {
 			if ok := room.Event(evt); ok {
 				return true
 			}
 		}
 		return false
 	case *slack.MessageEvent:
-		if r, ok := rs.objs[msg.ChannelId]; ok {
+		r := rs.get(msg.ChannelId)
+		if r == nil {
+			break
+		}
+		if msg.SubType != "channel_name" && msg.SubType != "group_name" {
 			return r.Event(evt)
 		}
-	case *slack.IMOpenEvent:
-		if rs.name == "ims" {
-			return rs.Open((*slack.ChannelInfoEvent)(msg))
+		oldName := r.Name()
+		changed := r.Event(evt)
+		rs.rename(r)
+		if c, ok := r.(*Channel); ok && rs.conn.all != nil {
+			rs.conn.all.Rename(c, oldName)
 		}
-	case *slack.GroupOpenEvent:
-		if rs.name == "groups" {
-			return rs.Open((*slack.ChannelInfoEvent)(msg))
+		return changed
+	case *slack.UserTypingEvent:
+		if r := rs.get(msg.ChannelId); r != nil {
+			return r.Event(evt)
+		}
+	case *slack.MemberJoinedChannelEvent:
+		if r := rs.get(msg.Channel); r != nil {
+			return rs.memberChange(r, evt)
+		}
+	case *slack.MemberLeftChannelEvent:
+		if r := rs.get(msg.Channel); r != nil {
+			return rs.memberChange(r, evt)
 		}
-	case *slack.IMCloseEvent:
-	case *slack.GroupCloseEvent:
 	}
 	return false
 }
+
+// get returns the room with the given ID, or nil.
+func (rs *RoomSet) get(id string) Room {
+	rs.Lock()
+	defer rs.Unlock()
+
+	return rs.objs[id]
+}
+
+// rooms returns every room we know about.
+func (rs *RoomSet) rooms() []Room {
+	rs.Lock()
+	defer rs.Unlock()
+
+	rooms := make([]Room, 0, len(rs.objs))
+	for _, r := range rs.objs {
+		rooms = append(rooms, r)
+	}
+	return rooms
+}
+
+// memberChange passes a member joined or left event to r.  MPIMs
+// are named after their members, so their by-name symlink has to
+// follow.
+func (rs *RoomSet) memberChange(r Room, evt slack.SlackEvent) bool {
+	changed := r.Event(evt)
+	if _, ok := r.(*MPIM); ok && changed {
+		rs.rename(r)
+	}
+	return changed
+}
+
+// rename points r's by-name symlink at its current name, if it is
+// shown.
+func (rs *RoomSet) rename(r Room) {
+	name := r.Name()
+
+	rs.Lock()
+	defer rs.Unlock()
+
+	if rs.ds.LookupId(r.Id()) == nil {
+		return
+	}
+	if err := rs.ds.Rename(r.Id(), name); err != nil {
+		log.Printf("Rename(%s): %s", r.Id(), err)
+	}
+}
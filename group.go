@@ -6,13 +6,21 @@ package slackfs
 
 import (
 	"fmt"
+	"sync"
 
+	"github.com/bpowers/fuse"
 	"github.com/bpowers/slack"
 )
 
 type Group struct {
 	slack.Group
 	Session
+
+	// protects the mutable metadata (topic, purpose, ...)
+	// in the embedded slack.Group
+	metaMu sync.Mutex
+
+	members *MemberDir
 }
 
 func NewGroup(sg slack.Group, conn *FSConn) *Group {
@@ -23,6 +31,17 @@ func NewGroup(sg slack.Group, conn *FSConn) *Group {
 	return g
 }
 
+// createGroup creates a new private group, which we are
+// automatically a member of.
+func (conn *FSConn) createGroup(name string) (Room, error) {
+	sg, err := conn.api.CreateGroup(name)
+	if err != nil {
+		return nil, apiErrno("CreateGroup", err)
+	}
+	sg.IsOpen = true
+	return NewGroup(*sg, conn), nil
+}
+
 func (g *Group) BaseChannel() *slack.BaseChannel {
 	return &g.Group.BaseChannel
 }
@@ -32,15 +51,140 @@ func (g *Group) Id() string {
 }
 
 func (g *Group) Name() string {
+	g.metaMu.Lock()
+	defer g.metaMu.Unlock()
+
 	return g.Group.Name
 }
 
 func (g *Group) IsOpen() bool {
+	g.metaMu.Lock()
+	defer g.metaMu.Unlock()
+
 	return g.Group.IsOpen
 }
 
+func (g *Group) setOpen(open bool) {
+	g.metaMu.Lock()
+	defer g.metaMu.Unlock()
+
+	g.Group.IsOpen = open
+}
+
+func (g *Group) Meta() RoomMeta {
+	g.metaMu.Lock()
+	defer g.metaMu.Unlock()
+
+	return RoomMeta{
+		Id:          g.Group.Id,
+		Name:        g.Group.Name,
+		Topic:       g.Topic.Value,
+		Purpose:     g.Purpose.Value,
+		Creator:     g.Creator,
+		Created:     g.Created.Time(),
+		IsArchived:  g.IsArchived,
+		MemberCount: len(g.Members),
+	}
+}
+
+func (g *Group) Event(evt slack.SlackEvent) bool {
+	changed := applyMemberChange(evt, g.Id(), &g.metaMu, &g.Group.Members, g.members)
+	if msg, ok := evt.Data.(*slack.MessageEvent); ok && msg.ChannelId == g.Id() {
+		g.metaMu.Lock()
+		changed = applyMetaMsg((*slack.Message)(msg), &g.Group.Name,
+			&g.Topic.Value, &g.Purpose.Value, &g.IsArchived) || changed
+		g.metaMu.Unlock()
+	}
+	if changed && g.dir != nil {
+		g.dir.UpdateChildren()
+	}
+	switch evt.Data.(type) {
+	case *slack.MemberJoinedChannelEvent, *slack.MemberLeftChannelEvent:
+		return changed
+	}
+	return g.Session.Event(evt)
+}
+
+func (g *Group) Ctl(cmd, arg string) error {
+	api := g.conn.api
+	if api == nil {
+		// offline
+		return fuse.ENOSYS
+	}
+	switch cmd {
+	case "join":
+		// we can only reopen groups we are already a member of.
+		if _, _, err := api.OpenGroup(g.Id()); err != nil {
+			return apiErrno("OpenGroup", err)
+		}
+		g.setOpen(true)
+		return g.conn.groups.Show(g)
+	case "leave":
+		if err := api.LeaveGroup(g.Id()); err != nil {
+			return apiErrno("LeaveGroup", err)
+		}
+		g.setOpen(false)
+		return g.conn.groups.Hide(g.Id())
+	case "close":
+		if _, _, err := api.CloseGroup(g.Id()); err != nil {
+			return apiErrno("CloseGroup", err)
+		}
+		g.setOpen(false)
+		return g.conn.groups.Hide(g.Id())
+	case "topic":
+		topic, err := api.SetGroupTopic(g.Id(), arg)
+		if err != nil {
+			return apiErrno("SetGroupTopic", err)
+		}
+		g.metaMu.Lock()
+		g.Topic.Value = topic
+		g.metaMu.Unlock()
+		g.dir.UpdateChildren()
+		return nil
+	case "purpose":
+		purpose, err := api.SetGroupPurpose(g.Id(), arg)
+		if err != nil {
+			return apiErrno("SetGroupPurpose", err)
+		}
+		g.metaMu.Lock()
+		g.Purpose.Value = purpose
+		g.metaMu.Unlock()
+		g.dir.UpdateChildren()
+		return nil
+	case "invite":
+		u, err := g.conn.ctlUser(arg)
+		if err != nil {
+			return err
+		}
+		if _, _, err = api.InviteUserToGroup(g.Id(), u.Id); err != nil {
+			return apiErrno("InviteUserToGroup", err)
+		}
+		return nil
+	case "kick":
+		u, err := g.conn.ctlUser(arg)
+		if err != nil {
+			return err
+		}
+		if err = api.KickUserFromGroup(g.Id(), u.Id); err != nil {
+			return apiErrno("KickUserFromGroup", err)
+		}
+		return nil
+	case "archive":
+		if err := api.ArchiveGroup(g.Id()); err != nil {
+			return apiErrno("ArchiveGroup", err)
+		}
+		g.metaMu.Lock()
+		g.IsArchived = true
+		g.Group.IsOpen = false
+		g.metaMu.Unlock()
+		return g.conn.groups.Hide(g.Id())
+	}
+	return errBadCtl
+}
+
 func NewGroupDir(parent *DirNode, id string, priv interface{}) (*DirNode, error) {
-	if _, ok := priv.(*Group); !ok {
+	g, ok := priv.(*Group)
+	if !ok {
 		return nil, fmt.Errorf("NewGroupDir called w non-group: %#v", priv)
 	}
 
@@ -56,6 +200,16 @@ func NewGroupDir(parent *DirNode, id string, priv interface{}) (*DirNode, error)
 		}
 		n.Activate()
 	}
+	if err = newMetaDir(dir, g, g.conn); err != nil {
+		return nil, fmt.Errorf("newMetaDir: %s", err)
+	}
+	g.metaMu.Lock()
+	ids := append([]string(nil), g.Group.Members...)
+	g.metaMu.Unlock()
+	if g.members, err = NewMemberDir(dir, g.conn, ids); err != nil {
+		return nil, fmt.Errorf("NewMemberDir: %s", err)
+	}
+	g.dir = dir
 
 	return dir, nil
 }
@@ -6,7 +6,11 @@ package slackfs
 
 import (
 	"fmt"
+	"log"
+	"sync"
+	"syscall"
 
+	"github.com/bpowers/fuse"
 	"github.com/bpowers/slack"
 )
 
@@ -14,7 +18,8 @@ type IM struct {
 	slack.IM
 	Session
 
-	dir *DirNode
+	// protects IsOpen in the embedded slack.IM
+	metaMu sync.Mutex
 }
 
 func NewIM(sim slack.IM, conn *FSConn) *IM {
@@ -38,13 +43,123 @@ func (im *IM) Name() string {
 	if u == nil {
 		return im.IM.UserId
 	}
-	return u.Name
+	return u.name()
 }
 
 func (im *IM) IsOpen() bool {
+	im.metaMu.Lock()
+	defer im.metaMu.Unlock()
+
 	return im.IM.IsOpen
 }
 
+func (im *IM) setOpen(open bool) {
+	im.metaMu.Lock()
+	defer im.metaMu.Unlock()
+
+	im.IM.IsOpen = open
+}
+
+// IMs only support being opened and closed; everything else about
+// them is fixed.
+func (im *IM) Ctl(cmd, arg string) error {
+	api := im.conn.api
+	if api == nil {
+		// offline
+		return fuse.ENOSYS
+	}
+	switch cmd {
+	case "join":
+		if _, _, _, err := api.OpenIMChannel(im.UserId); err != nil {
+			return apiErrno("OpenIMChannel", err)
+		}
+		im.setOpen(true)
+		if err := im.conn.ims.Show(im); err != nil {
+			return err
+		}
+		im.conn.users.LinkIM(im.UserId, im.conn.roomDir(im.Id()))
+		return nil
+	case "close", "leave":
+		if _, _, err := api.CloseIMChannel(im.Id()); err != nil {
+			return apiErrno("CloseIMChannel", err)
+		}
+		im.setOpen(false)
+		im.conn.users.LinkIM(im.UserId, nil)
+		return im.conn.ims.Hide(im.Id())
+	}
+	return errBadCtl
+}
+
+// imMaker lets a DM be started with 'mkdir ims/by-name/$username'.
+// mkdir fails with EEXIST if the DM is already open.  DMs are closed
+// by removing their by-id directory (see roomIdMaker).
+type imMaker struct {
+	rs *RoomSet
+}
+
+// find returns the IM we already know about with the given user,
+// if any.
+func (m *imMaker) find(userId string) *IM {
+	m.rs.Lock()
+	defer m.rs.Unlock()
+
+	for _, room := range m.rs.objs {
+		if im, ok := room.(*IM); ok && im.UserId == userId {
+			return im
+		}
+	}
+	return nil
+}
+
+func (m *imMaker) Mkdir(name string) (INode, error) {
+	conn := m.rs.conn
+	if conn.api == nil {
+		return nil, fuse.ENOSYS
+	}
+
+	u := conn.users.Lookup(name)
+	if u == nil {
+		return nil, fuse.ENOENT
+	}
+
+	im := m.find(u.Id)
+	if im != nil && conn.roomDir(im.Id()) != nil {
+		return nil, fuse.Errno(syscall.EEXIST)
+	}
+
+	_, _, id, err := conn.api.OpenIMChannel(u.Id)
+	if err != nil {
+		return nil, apiErrno("OpenIMChannel", err)
+	}
+
+	if im == nil {
+		var sim slack.IM
+		sim.Id = id
+		sim.IsIM = true
+		sim.UserId = u.Id
+		im = NewIM(sim, conn)
+	}
+	im.setOpen(true)
+
+	// Show adds the by-id directory and by-name symlink, and
+	// starts the session.
+	if err = m.rs.Show(im); err != nil {
+		log.Printf("Show(%s): %s", id, err)
+		return nil, fuse.EIO
+	}
+
+	// the new by-name entry is a symlink, which the kernel won't
+	// accept as the result of a mkdir, so hand back the by-id
+	// directory it points to.  Once the kernel's entry for the
+	// name expires, lookups find the symlink again.
+	dir := conn.roomDir(id)
+	if dir == nil {
+		return nil, fuse.EIO
+	}
+	conn.users.LinkIM(u.Id, dir)
+	return dir, nil
+}
+
 func NewIMDir(parent *DirNode, id string, priv interface{}) (*DirNode, error) {
 	if _, ok := priv.(*IM); !ok {
 		return nil, fmt.Errorf("NewIMDir called w non-im: %#v", priv)
@@ -0,0 +1,169 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/bpowers/slack"
+)
+
+// MemberDir is the members/ directory of a room, containing a
+// symlink named by username into users/by-id for each member.
+type MemberDir struct {
+	mu   sync.Mutex
+	dn   *DirNode
+	conn *FSConn
+	syms map[string]*SymlinkNode // keyed by user ID
+}
+
+func NewMemberDir(parent *DirNode, conn *FSConn, ids []string) (*MemberDir, error) {
+	var err error
+	md := new(MemberDir)
+	md.conn = conn
+	md.syms = make(map[string]*SymlinkNode)
+	md.dn, err = NewDirNode(parent, "members", parent.priv)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode(members): %s", err)
+	}
+
+	for _, id := range ids {
+		if err = md.Add(id); err != nil {
+			return nil, fmt.Errorf("Add(%s): %s", id, err)
+		}
+	}
+
+	md.dn.Activate()
+	return md, nil
+}
+
+func (md *MemberDir) Add(id string) error {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+
+	if _, ok := md.syms[id]; ok {
+		return nil
+	}
+	u := md.conn.users.Get(id)
+	userDir := md.conn.users.Dir(id)
+	if u == nil || userDir == nil {
+		// deleted users don't have directories to link to.
+		return nil
+	}
+	name := u.name()
+	s, err := NewSymlinkNode(md.dn, name, userDir)
+	if err != nil {
+		return fmt.Errorf("NewSymlinkNode(%s): %s", name, err)
+	}
+	md.syms[id] = s
+	s.Activate()
+	return nil
+}
+
+func (md *MemberDir) Remove(id string) {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+
+	s, ok := md.syms[id]
+	if !ok {
+		return
+	}
+	md.dn.removeChild(s.Name())
+	delete(md.syms, id)
+}
+
+// Rename renames the symlink for the member with the given ID after
+// their username changes, returning false if they aren't a member.
+func (md *MemberDir) Rename(id string) bool {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+
+	s, ok := md.syms[id]
+	if !ok {
+		return false
+	}
+	u := md.conn.users.Get(id)
+	if u == nil || u.name() == s.Name() {
+		return true
+	}
+	name := u.name()
+	ns, err := NewSymlinkNode(md.dn, name, s.target)
+	if err != nil {
+		log.Printf("NewSymlinkNode(%s): %s", name, err)
+		return true
+	}
+	md.dn.removeChild(s.Name())
+	md.syms[id] = ns
+	ns.Activate()
+	return true
+}
+
+// memberChange figures out whether evt adds or removes someone from
+// the room with the given ID, returning the user ID affected.
+func memberChange(evt slack.SlackEvent, roomId string) (userId string, joined, ok bool) {
+	switch msg := evt.Data.(type) {
+	case *slack.MemberJoinedChannelEvent:
+		return msg.User, true, msg.Channel == roomId
+	case *slack.MemberLeftChannelEvent:
+		return msg.User, false, msg.Channel == roomId
+	case *slack.MessageEvent:
+		if msg.ChannelId != roomId {
+			return "", false, false
+		}
+		switch msg.SubType {
+		case "channel_join", "group_join":
+			return msg.UserId, true, true
+		case "channel_leave", "group_leave":
+			return msg.UserId, false, true
+		}
+	}
+	return "", false, false
+}
+
+// updateMembers applies a join or leave to a room's member list,
+// returning the new list.
+func updateMembers(ids []string, userId string, joined bool) []string {
+	for i, id := range ids {
+		if id != userId {
+			continue
+		}
+		if joined {
+			return ids
+		}
+		return append(ids[:i], ids[i+1:]...)
+	}
+	if joined {
+		ids = append(ids, userId)
+	}
+	return ids
+}
+
+// applyMemberChange keeps both the member list and the members/
+// directory in sync with evt.  It returns true if evt was a
+// membership event for the room, in which case the room's other
+// attributes need an Update.
+func applyMemberChange(evt slack.SlackEvent, roomId string, mu *sync.Mutex, ids *[]string, md *MemberDir) bool {
+	userId, joined, ok := memberChange(evt, roomId)
+	if !ok {
+		return false
+	}
+	mu.Lock()
+	*ids = updateMembers(*ids, userId, joined)
+	mu.Unlock()
+
+	if md == nil {
+		return true
+	}
+	if joined {
+		if err := md.Add(userId); err != nil {
+			log.Printf("members.Add(%s): %s", userId, err)
+		}
+	} else {
+		md.Remove(userId)
+	}
+	return true
+}
@@ -0,0 +1,384 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bpowers/fuse"
+	"github.com/bpowers/fuse/fs"
+	"github.com/bpowers/slack"
+	"golang.org/x/net/context"
+)
+
+// RoomMsg is a single message known to a room's Session, and backs
+// that message's messages/<ts>/ directory.
+type RoomMsg struct {
+	mu      sync.Mutex
+	msg     slack.Message
+	session *Session
+}
+
+func NewRoomMsg(msg slack.Message, s *Session) *RoomMsg {
+	m := new(RoomMsg)
+	m.msg = msg
+	m.session = s
+
+	return m
+}
+
+// Get returns a copy of the underlying message.
+func (m *RoomMsg) Get() slack.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.msg
+}
+
+// setText records an edit to the message.  Its attributes are
+// generated when read, so there is nothing else to update.
+func (m *RoomMsg) setText(text string, edited *slack.Edited) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.msg.Text = text
+	if edited != nil {
+		m.msg.Edited = edited
+	}
+}
+
+// IsOwn returns true if we are the author of the message, which is
+// a requirement for editing or deleting it.
+func (m *RoomMsg) IsOwn() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.msg.UserId == m.session.conn.self.userId
+}
+
+// msgAttrNode is a read-only attribute whose contents are derived
+// from the parent directory's RoomMsg.  There can be thousands of
+// messages, so rather than keeping each attribute's contents around
+// they are generated on every read.
+type msgAttrNode struct {
+	AttrNode
+	val func(m *RoomMsg, msg *slack.Message) string
+}
+
+func newMsgAttr(name string, val func(m *RoomMsg, msg *slack.Message) string) AttrFactory {
+	return func(parent *DirNode) (INode, error) {
+		n := new(msgAttrNode)
+		if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+			return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+		}
+		n.val = val
+		n.mode = 0444
+		return n, nil
+	}
+}
+
+// Open disables the page cache: our size isn't known until the
+// contents are generated.
+func (n *msgAttrNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	resp.Flags |= fuse.OpenDirectIO
+	return n, nil
+}
+
+func (n *msgAttrNode) ReadAll(ctx context.Context) ([]byte, error) {
+	m := n.parent.priv.(*RoomMsg)
+	msg := m.Get()
+	return []byte(n.val(m, &msg)), nil
+}
+
+func (n *msgAttrNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
+
+// msgTextNode is the text file of a message.  For our own messages,
+// writing to it edits the message, and unlinking it deletes it.
+type msgTextNode struct {
+	msgAttrNode
+}
+
+func newMsgText(parent *DirNode) (INode, error) {
+	name := "text"
+	n := new(msgTextNode)
+	if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+		return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+	}
+	n.val = func(m *RoomMsg, msg *slack.Message) string {
+		return msg.Text + "\n"
+	}
+	n.mode = 0444
+	if parent.priv.(*RoomMsg).IsOwn() {
+		n.mode = 0644
+	}
+	return n, nil
+}
+
+func (n *msgTextNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	resp.Flags |= fuse.OpenDirectIO
+	if req.Flags.IsReadOnly() {
+		return n, nil
+	}
+	if !n.parent.priv.(*RoomMsg).IsOwn() {
+		return nil, fuse.EPERM
+	}
+	h := new(msgTextHandle)
+	h.n = n
+	return h, nil
+}
+
+// Setattr is a no-op, but necessary so that opening with O_TRUNC
+// (as the shell does for '>') succeeds.
+func (n *msgTextNode) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	n.Attr(&resp.Attr)
+	return nil
+}
+
+func (n *msgTextNode) Unlink() error {
+	m := n.parent.priv.(*RoomMsg)
+	return m.session.DeleteMessage(m.Get().Timestamp)
+}
+
+func (n *msgTextNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
+
+// msgTextHandle collects the new text of a message, and calls
+// chat.update when it is closed.
+type msgTextHandle struct {
+	n *msgTextNode
+
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	dirty bool
+}
+
+func (h *msgTextHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buf.Write(req.Data)
+	h.dirty = true
+	resp.Size = len(req.Data)
+	return nil
+}
+
+func (h *msgTextHandle) ReadAll(ctx context.Context) ([]byte, error) {
+	return h.n.ReadAll(ctx)
+}
+
+// must be called with h.mu held
+func (h *msgTextHandle) flush() error {
+	if !h.dirty {
+		return nil
+	}
+	h.dirty = false
+
+	text := bytes.TrimRight(h.buf.Bytes(), " \t\r\n")
+	h.buf.Reset()
+	if len(text) == 0 {
+		// an empty message can't be sent, so treat
+		// truncation without a write as a no-op.
+		return nil
+	}
+	m := h.n.parent.priv.(*RoomMsg)
+	return m.session.EditMessage(m.Get().Timestamp, string(text))
+}
+
+func (h *msgTextHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flush()
+}
+
+func (h *msgTextHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flush()
+}
+
+var msgAttrs = []AttrFactory{
+	newMsgText,
+	newMsgAttr("ts", func(m *RoomMsg, msg *slack.Message) string {
+		return msg.Timestamp + "\n"
+	}),
+	newMsgAttr("time", func(m *RoomMsg, msg *slack.Message) string {
+		t, err := ParseTimestamp(msg.Timestamp)
+		if err != nil {
+			return "\n"
+		}
+		return t.Time().In(m.session.conn.displayLoc()).Format(time.RFC3339Nano) + "\n"
+	}),
+	newMsgAttr("subtype", func(m *RoomMsg, msg *slack.Message) string {
+		return msg.SubType + "\n"
+	}),
+	newMsgAttr("permalink", func(m *RoomMsg, msg *slack.Message) string {
+		return m.session.conn.permalink(m.session.id, msg.Timestamp) + "\n"
+	}),
+	newMsgAttr("raw.json", func(m *RoomMsg, msg *slack.Message) string {
+		buf, err := json.MarshalIndent(msg, "", "    ")
+		if err != nil {
+			log.Printf("MarshalIndent(%s): %s", msg.Timestamp, err)
+			return ""
+		}
+		return string(buf) + "\n"
+	}),
+}
+
+// NewMessageDir creates the messages/<ts>/ directory for m, with a
+// user symlink pointing at the message's author.
+func NewMessageDir(parent *DirNode, m *RoomMsg) (*DirNode, error) {
+	msg := m.Get()
+	dir, err := NewDirNode(parent, msg.Timestamp, m)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode: %s", err)
+	}
+
+	for _, attrFactory := range msgAttrs {
+		n, err := attrFactory(dir)
+		if err != nil {
+			return nil, fmt.Errorf("attrFactory: %s", err)
+		}
+		n.Activate()
+	}
+
+	if userDir := m.session.conn.users.Dir(msg.UserId); userDir != nil {
+		s, err := NewSymlinkNode(dir, "user", userDir)
+		if err != nil {
+			return nil, fmt.Errorf("NewSymlinkNode(user): %s", err)
+		}
+		s.Activate()
+	}
+
+	return dir, nil
+}
+
+// MessageDirOwner is implemented by Session, and through embedding,
+// by every Room.
+type MessageDirOwner interface {
+	setMsgDir(dn *DirNode)
+}
+
+func newMessages(parent *DirNode) (INode, error) {
+	owner, ok := parent.priv.(MessageDirOwner)
+	if !ok {
+		return nil, fmt.Errorf("newMessages called w non-session: %#v", parent.priv)
+	}
+
+	dir, err := NewDirNode(parent, "messages", parent.priv)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode(messages): %s", err)
+	}
+	owner.setMsgDir(dir)
+
+	return dir, nil
+}
+
+// msgDirMaker allows our own messages to be deleted by removing
+// their messages/<ts>/ directory.
+type msgDirMaker struct {
+	s *Session
+}
+
+func (md msgDirMaker) Mkdir(name string) (INode, error) {
+	return nil, fuse.EPERM
+}
+
+func (md msgDirMaker) Rmdir(ts string) error {
+	return md.s.DeleteMessage(ts)
+}
+
+// lookupMsg returns the message with timestamp ts, or nil.
+func (s *Session) lookupMsg(ts string) *RoomMsg {
+	t, err := ParseTimestamp(ts)
+	if err != nil {
+		return nil
+	}
+
+	s.L.Lock()
+	defer s.L.Unlock()
+
+	return s.msgs[t]
+}
+
+// EditMessage replaces the text of one of our own messages.
+func (s *Session) EditMessage(ts, text string) error {
+	if s.conn.api == nil {
+		// offline
+		return fuse.ENOSYS
+	}
+	m := s.lookupMsg(ts)
+	if m == nil {
+		return fuse.ENOENT
+	}
+	if !m.IsOwn() {
+		return fuse.EPERM
+	}
+	if _, _, _, err := s.conn.api.UpdateMessage(s.id, ts, text); err != nil {
+		return apiErrno("UpdateMessage", err)
+	}
+	// the session is updated when the message_changed event
+	// comes back over the websocket, but update our attributes
+	// now so that a read after write sees the change.
+	m.setText(text, nil)
+	return nil
+}
+
+// DeleteMessage deletes one of our own messages.
+func (s *Session) DeleteMessage(ts string) error {
+	if s.conn.api == nil {
+		// offline
+		return fuse.ENOSYS
+	}
+	m := s.lookupMsg(ts)
+	if m == nil {
+		return fuse.ENOENT
+	}
+	if !m.IsOwn() {
+		return fuse.EPERM
+	}
+	if _, _, err := s.conn.api.DeleteMessage(s.id, ts); err != nil {
+		return apiErrno("DeleteMessage", err)
+	}
+
+	// hide the directory now, but keep the message around
+	// until the message_deleted event arrives so that the
+	// session can say who deleted what.
+	s.L.Lock()
+	defer s.L.Unlock()
+	if s.msgDir != nil {
+		s.msgDir.removeChild(m.Get().Timestamp)
+	}
+	return nil
+}
+
+// must be called with s.L held
+func (s *Session) forgetMsg(ts Timestamp) {
+	m, ok := s.msgs[ts]
+	if !ok {
+		return
+	}
+	delete(s.msgs, ts)
+	if s.msgDir != nil {
+		s.msgDir.removeChild(m.Get().Timestamp)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bpowers/fuse"
+	"github.com/bpowers/slack"
+)
+
+// MPIM is a multi-party direct message.  Slack models these as
+// private groups with a fixed set of members, and they share the
+// groups.* history API.
+type MPIM struct {
+	slack.Group
+	Session
+
+	// protects Members and IsOpen in the embedded slack.Group
+	metaMu sync.Mutex
+
+	members *MemberDir
+}
+
+func NewMPIM(sg slack.Group, conn *FSConn) *MPIM {
+	m := new(MPIM)
+	m.Group = sg
+	m.Session.Init(m, conn, conn.api.GetGroupHistory)
+
+	return m
+}
+
+func (m *MPIM) BaseChannel() *slack.BaseChannel {
+	return &m.Group.BaseChannel
+}
+
+func (m *MPIM) Id() string {
+	return m.Group.Id
+}
+
+// Name is the sorted, comma-separated list of participants'
+// usernames, rather than Slack's generated 'mpdm-...' name.
+func (m *MPIM) Name() string {
+	m.metaMu.Lock()
+	ids := append([]string(nil), m.Members...)
+	m.metaMu.Unlock()
+
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if u := m.conn.users.Get(id); u != nil {
+			names = append(names, u.name())
+		} else {
+			names = append(names, id)
+		}
+	}
+	if len(names) == 0 {
+		return m.Group.Name
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (m *MPIM) IsOpen() bool {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+
+	return m.Group.IsOpen
+}
+
+func (m *MPIM) setOpen(open bool) {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+
+	m.Group.IsOpen = open
+}
+
+func (m *MPIM) Event(evt slack.SlackEvent) bool {
+	changed := applyMemberChange(evt, m.Id(), &m.metaMu, &m.Group.Members, m.members)
+	switch evt.Data.(type) {
+	case *slack.MemberJoinedChannelEvent, *slack.MemberLeftChannelEvent:
+		return changed
+	}
+	return m.Session.Event(evt)
+}
+
+// Like IMs, MPIMs can only be opened and closed.
+func (m *MPIM) Ctl(cmd, arg string) error {
+	if m.conn.api == nil {
+		// offline
+		return fuse.ENOSYS
+	}
+	args := url.Values{}
+	switch cmd {
+	case "join":
+		m.metaMu.Lock()
+		args.Set("users", strings.Join(m.Members, ","))
+		m.metaMu.Unlock()
+		if err := m.conn.apiCall("mpim.open", args, nil); err != nil {
+			return apiErrno("mpim.open", err)
+		}
+		m.setOpen(true)
+		return m.conn.mpims.Show(m)
+	case "close", "leave":
+		args.Set("channel", m.Id())
+		if err := m.conn.apiCall("mpim.close", args, nil); err != nil {
+			return apiErrno("mpim.close", err)
+		}
+		m.setOpen(false)
+		return m.conn.mpims.Hide(m.Id())
+	}
+	return errBadCtl
+}
+
+func NewMPIMDir(parent *DirNode, id string, priv interface{}) (*DirNode, error) {
+	m, ok := priv.(*MPIM)
+	if !ok {
+		return nil, fmt.Errorf("NewMPIMDir called w non-mpim: %#v", priv)
+	}
+
+	dir, err := NewDirNode(parent, id, priv)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode: %s", err)
+	}
+
+	for _, attrFactory := range roomAttrs {
+		n, err := attrFactory(dir)
+		if err != nil {
+			return nil, fmt.Errorf("attrFactory: %s", err)
+		}
+		n.Activate()
+	}
+	m.metaMu.Lock()
+	ids := append([]string(nil), m.Members...)
+	m.metaMu.Unlock()
+	if m.members, err = NewMemberDir(dir, m.conn, ids); err != nil {
+		return nil, fmt.Errorf("NewMemberDir: %s", err)
+	}
+	m.dir = dir
+
+	return dir, nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bpowers/fuse"
+	"github.com/bpowers/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// remoteClient fetches remote files.  Unlike http.DefaultClient it
+// gives up eventually, so a stalled server can't hang a read forever.
+var remoteClient = &http.Client{Timeout: 30 * time.Second}
+
+// remoteNode is a read-only file whose contents live at a URL, like
+// an avatar or a custom emoji.  It is downloaded when first read,
+// and cached on disk (if there is a cache directory) so that later
+// mounts don't have to fetch it again.  Only without a cache
+// directory are the contents kept in memory.
+type remoteNode struct {
+	AttrNode
+
+	// url returns where our contents currently live, or "" if
+	// there is nothing there.
+	url func() string
+	// cachePath returns where the contents of url are stored on
+	// disk, or "" if caching is disabled.
+	cachePath func(url string) string
+
+	// protects fetched and data, but isn't held while
+	// downloading.
+	mu      sync.Mutex
+	fetched string // the URL data was fetched from
+	data    []byte // nil if there is a disk cache
+}
+
+func newRemoteNode(parent *DirNode, name string, url func() string, cachePath func(string) string) (*remoteNode, error) {
+	n := new(remoteNode)
+	if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+		return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+	}
+	n.url = url
+	n.cachePath = cachePath
+	n.mode = 0444
+	return n, nil
+}
+
+// cacheFile returns the path under the cache directory for the
+// contents of url.  Naming files after the URL means a changed image
+// is never served stale.
+func (conn *FSConn) cacheFile(subdir, prefix, url, ext string) string {
+	dir := conn.opts.CacheDir
+	if dir == "" || conn.team == nil {
+		return ""
+	}
+	sum := sha1.Sum([]byte(url))
+	name := fmt.Sprintf("%s-%x%s", prefix, sum[:6], ext)
+	return filepath.Join(dir, conn.team.Id, subdir, name)
+}
+
+// cached returns our contents if we already have them in memory or
+// on disk, without fetching them.
+//
+// must be called with n.mu held
+func (n *remoteNode) cached(url string) []byte {
+	if n.data != nil && n.fetched == url {
+		return n.data
+	}
+	path := n.cachePath(url)
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// cachedSize returns the size of our contents if we have them in
+// memory or on disk, or 0.
+func (n *remoteNode) cachedSize(url string) uint64 {
+	n.mu.Lock()
+	inMemory := n.data != nil && n.fetched == url
+	size := uint64(len(n.data))
+	n.mu.Unlock()
+	if inMemory {
+		return size
+	}
+
+	path := n.cachePath(url)
+	if path == "" {
+		return 0
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return uint64(fi.Size())
+}
+
+// fetch returns our contents, downloading them if they aren't
+// cached.  Two callers may both download the same URL; the second
+// to finish wins, which is harmless.
+func (n *remoteNode) fetch() ([]byte, error) {
+	url := n.url()
+	if url == "" {
+		return nil, fuse.ENOENT
+	}
+	n.mu.Lock()
+	data := n.cached(url)
+	n.mu.Unlock()
+	if data != nil {
+		return data, nil
+	}
+
+	resp, err := remoteClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Get(%s): %s", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Get(%s): %s", url, resp.Status)
+	}
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ReadAll(%s): %s", url, err)
+	}
+
+	if path := n.cachePath(url); path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			log.Printf("MkdirAll(%s): %s", filepath.Dir(path), err)
+		} else if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			log.Printf("WriteFile(%s): %s", path, err)
+		}
+		return data, nil
+	}
+
+	n.mu.Lock()
+	n.fetched = url
+	n.data = data
+	n.mu.Unlock()
+	return data, nil
+}
+
+// Attr reports our real size once we have our contents, but doesn't
+// fetch them: stat and ls shouldn't download anything.  Until we've
+// been read the size is 0, and Open arranges for reads to bypass the
+// page cache.
+func (n *remoteNode) Attr(a *fuse.Attr) {
+	a.Inode = n.ino
+	a.Mode = n.mode
+
+	if url := n.url(); url != "" {
+		a.Size = n.cachedSize(url)
+	}
+}
+
+func (n *remoteNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if _, err := n.fetch(); err != nil {
+		log.Printf("remote %s: %s", n.name, err)
+		return nil, fuse.EIO
+	}
+	resp.Flags |= fuse.OpenDirectIO
+	return n, nil
+}
+
+func (n *remoteNode) ReadAll(ctx context.Context) ([]byte, error) {
+	data, err := n.fetch()
+	if err != nil {
+		log.Printf("remote %s: %s", n.name, err)
+		return nil, fuse.EIO
+	}
+	return data, nil
+}
+
+// urlExt returns the file extension of the path in rawurl, or def if
+// it has none.
+func urlExt(rawurl, def string) string {
+	if u, err := url.Parse(rawurl); err == nil && path.Ext(u.Path) != "" {
+		return path.Ext(u.Path)
+	}
+	return def
+}
+
+func (n *remoteNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bpowers/slack"
+)
+
+// RoomMeta is a snapshot of the descriptive fields shared by
+// channels and groups.
+type RoomMeta struct {
+	Id          string
+	Name        string
+	Topic       string
+	Purpose     string
+	Creator     string
+	Created     time.Time
+	IsArchived  bool
+	IsGeneral   bool
+	MemberCount int
+}
+
+// MetaRoom is implemented by rooms that have a topic, purpose and
+// the rest of RoomMeta (channels and groups, but not IMs).
+type MetaRoom interface {
+	Room
+	Meta() RoomMeta
+}
+
+// applyMetaMsg updates the fields of a channel or group in response
+// to message subtypes like channel_topic.  It returns true if
+// anything changed.
+func applyMetaMsg(msg *slack.Message, name, topic, purpose *string, archived *bool) bool {
+	switch msg.SubType {
+	case "channel_topic", "group_topic":
+		*topic = msg.Topic
+	case "channel_purpose", "group_purpose":
+		*purpose = msg.Purpose
+	case "channel_name", "group_name":
+		*name = msg.Name
+	case "channel_archive", "group_archive":
+		*archived = true
+	case "channel_unarchive", "group_unarchive":
+		*archived = false
+	default:
+		return false
+	}
+	return true
+}
+
+type roomMetaNode struct {
+	AttrNode
+	val func(m *RoomMeta) string
+}
+
+// newRoomMeta returns a factory for a read-only attribute whose
+// contents are derived from the parent room's RoomMeta.
+func newRoomMeta(name string, val func(m *RoomMeta) string) AttrFactory {
+	return func(parent *DirNode) (INode, error) {
+		n := new(roomMetaNode)
+		if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+			return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+		}
+		n.val = val
+		n.Update()
+		n.mode = 0444
+		return n, nil
+	}
+}
+
+func (n *roomMetaNode) Update() {
+	m := n.parent.priv.(MetaRoom).Meta()
+	n.updateCommon(n.val(&m) + "\n")
+}
+
+func (n *roomMetaNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
+
+func fmtBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+var metaAttrs = []AttrFactory{
+	newRoomMeta("id", func(m *RoomMeta) string { return m.Id }),
+	newRoomMeta("name", func(m *RoomMeta) string { return m.Name }),
+	newRoomMeta("topic", func(m *RoomMeta) string { return m.Topic }),
+	newRoomMeta("purpose", func(m *RoomMeta) string { return m.Purpose }),
+	newRoomMeta("created", func(m *RoomMeta) string { return m.Created.Format(time.RFC3339) }),
+	newRoomMeta("is-archived", func(m *RoomMeta) string { return fmtBool(m.IsArchived) }),
+	newRoomMeta("is-general", func(m *RoomMeta) string { return fmtBool(m.IsGeneral) }),
+	newRoomMeta("member-count", func(m *RoomMeta) string { return strconv.Itoa(m.MemberCount) }),
+}
+
+// newMetaDir adds the RoomMeta attributes, along with a symlink to
+// the room's creator, to a channel or group directory.
+func newMetaDir(dir *DirNode, room MetaRoom, conn *FSConn) error {
+	for _, attrFactory := range metaAttrs {
+		n, err := attrFactory(dir)
+		if err != nil {
+			return fmt.Errorf("attrFactory: %s", err)
+		}
+		n.Activate()
+	}
+
+	m := room.Meta()
+	if userDir := conn.users.Dir(m.Creator); userDir != nil {
+		s, err := NewSymlinkNode(dir, "creator", userDir)
+		if err != nil {
+			return fmt.Errorf("NewSymlinkNode(creator): %s", err)
+		}
+		s.Activate()
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"syscall"
+	"text/template"
+
+	"github.com/bpowers/fuse"
+	"github.com/bpowers/slack"
+	"golang.org/x/net/context"
+)
+
+// Search is the top-level search/ directory.  Making a directory
+// inside it runs a message search with the directory's name as the
+// query, and removing the directory discards the results.
+type Search struct {
+	mu      sync.Mutex
+	dn      *DirNode
+	conn    *FSConn
+	results map[string]*DirNode // nil while the search is running
+}
+
+func NewSearch(conn *FSConn) (*Search, error) {
+	var err error
+	s := new(Search)
+	s.conn = conn
+	s.results = make(map[string]*DirNode)
+	s.dn, err = NewDirNode(conn.root, "search", s)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode(search): %s", err)
+	}
+	s.dn.SetMaker(s)
+
+	s.dn.Activate()
+	return s, nil
+}
+
+func (s *Search) Mkdir(query string) (INode, error) {
+	if s.conn.api == nil {
+		return nil, fuse.ENOSYS
+	}
+
+	// reserve the query, so that we don't hold s.mu (and block
+	// lookups in search/) during the search itself.
+	s.mu.Lock()
+	if _, ok := s.results[query]; ok {
+		s.mu.Unlock()
+		return nil, fuse.Errno(syscall.EEXIST)
+	}
+	s.results[query] = nil
+	s.mu.Unlock()
+
+	dir, err := s.search(query)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		delete(s.results, query)
+		return nil, err
+	}
+	s.results[query] = dir
+	dir.Activate()
+
+	return dir, nil
+}
+
+func (s *Search) search(query string) (*DirNode, error) {
+	params := slack.NewSearchParameters()
+	params.Count = maxSearch
+	results, err := s.conn.api.SearchMessages(query, params)
+	if err != nil {
+		return nil, apiErrno("SearchMessages", err)
+	}
+
+	dir, err := NewSearchDir(s.dn, query, results, s.conn)
+	if err != nil {
+		log.Printf("NewSearchDir(%s): %s", query, err)
+		return nil, fuse.EIO
+	}
+	return dir, nil
+}
+
+func (s *Search) Rmdir(query string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir, ok := s.results[query]
+	if !ok {
+		return fuse.ENOENT
+	}
+	if dir == nil {
+		return fuse.Errno(syscall.EBUSY)
+	}
+	s.dn.removeChild(query)
+	delete(s.results, query)
+	return nil
+}
+
+// maximum number of search hits we ask for
+const maxSearch = 100
+
+// NewSearchDir creates the directory holding the results of a single
+// search: results (formatted like a room's session), results.json,
+// and hits/, with a symlink for each hit pointing at its room.
+func NewSearchDir(parent *DirNode, query string, results *slack.SearchMessages, conn *FSConn) (*DirNode, error) {
+	dir, err := NewDirNode(parent, query, results)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode: %s", err)
+	}
+
+	hits := make([]slack.SearchMessage, len(results.Matches))
+	copy(hits, results.Matches)
+	sortByTs(len(hits), func(i int) string {
+		return hits[i].Timestamp
+	}, func(i, j int) {
+		hits[i], hits[j] = hits[j], hits[i]
+	})
+
+	var formatted bytes.Buffer
+	t := template.Must(template.New("msg").Funcs(msgFuncs(conn)).Parse(conn.templates().Msg))
+	for _, hit := range hits {
+		var msg slack.Message
+		msg.UserId = hit.User
+		msg.ChannelId = hit.Channel.Id
+		msg.Timestamp = hit.Timestamp
+		msg.Text = hit.Text
+		if err := t.Execute(&formatted, &msg); err != nil {
+			log.Printf("Execute(%#v): %s", msg, err)
+		}
+	}
+
+	buf, err := json.MarshalIndent(results, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("MarshalIndent: %s", err)
+	}
+
+	for name, content := range map[string][]byte{
+		"results":      formatted.Bytes(),
+		"results.json": append(buf, '\n'),
+	} {
+		n, err := newSearchAttr(dir, name, content)
+		if err != nil {
+			return nil, err
+		}
+		n.Activate()
+	}
+
+	hitsDir, err := NewDirNode(dir, "hits", results)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode(hits): %s", err)
+	}
+	for i, hit := range hits {
+		roomDir := conn.roomDir(hit.Channel.Id)
+		if roomDir == nil {
+			// a room we aren't in, or one that is closed.
+			continue
+		}
+		name := fmt.Sprintf("%03d-%s", i, hit.Timestamp)
+		s, err := NewSymlinkNode(hitsDir, name, roomDir)
+		if err != nil {
+			return nil, fmt.Errorf("NewSymlinkNode(%s): %s", name, err)
+		}
+		s.Activate()
+	}
+	hitsDir.Activate()
+
+	return dir, nil
+}
+
+// searchAttrNode is a read-only file in a search's directory.  An
+// AttrNode with no content fails reads with ENOSYS (it is taken to
+// be write-only), but a search with no hits should have empty
+// results instead.
+type searchAttrNode struct {
+	AttrNode
+	content []byte
+}
+
+func newSearchAttr(parent *DirNode, name string, content []byte) (*searchAttrNode, error) {
+	n := new(searchAttrNode)
+	if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+		return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+	}
+	n.content = content
+	n.size = uint64(len(content))
+	n.mode = 0444
+	return n, nil
+}
+
+func (n *searchAttrNode) ReadAll(ctx context.Context) ([]byte, error) {
+	return n.content, nil
+}
+
+func (n *searchAttrNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
@@ -0,0 +1,412 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bpowers/fuse"
+	"github.com/bpowers/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// selfAttrNode is a read-write file under /self.  Reads are
+// generated on demand (often with an API call).  Writes are
+// collected per open file and applied when it is closed, with
+// errors reported to the writer.
+type selfAttrNode struct {
+	AttrNode
+	get func(self *Self) (string, error)
+	set func(self *Self, val string) error
+	// if set, truncating the file sets it to the empty string.
+	clearable bool
+
+	mu      sync.Mutex
+	writers map[*selfAttrHandle]bool
+}
+
+func newSelfAttr(parent *DirNode, name string, get func(*Self) (string, error), set func(*Self, string) error) (*selfAttrNode, error) {
+	n := new(selfAttrNode)
+	if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+		return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+	}
+	n.get = get
+	n.set = set
+	n.mode = 0644
+	return n, nil
+}
+
+func (n *selfAttrNode) self() *Self {
+	return n.parent.priv.(*FSConn).self
+}
+
+// Open disables the page cache: our size isn't known until the
+// contents are generated.
+func (n *selfAttrNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	resp.Flags |= fuse.OpenDirectIO
+	if req.Flags.IsReadOnly() {
+		return n, nil
+	}
+	h := new(selfAttrHandle)
+	h.n = n
+
+	n.mu.Lock()
+	if n.writers == nil {
+		n.writers = make(map[*selfAttrHandle]bool)
+	}
+	n.writers[h] = true
+	n.mu.Unlock()
+	return h, nil
+}
+
+func (n *selfAttrNode) ReadAll(ctx context.Context) ([]byte, error) {
+	val, err := n.get(n.self())
+	if err != nil {
+		return nil, err
+	}
+	return []byte(val), nil
+}
+
+// Setattr is needed so that opening with O_TRUNC (as the shell does
+// for '>') succeeds.  Truncating a clearable file to zero (as with
+// ': > self/status') clears it.  If the file is open for writing,
+// the clear is left to the handles, so that 'echo x > self/status'
+// sets the status once rather than clearing it first.
+func (n *selfAttrNode) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	n.Attr(&resp.Attr)
+	if !req.Valid.Size() || req.Size != 0 || !n.clearable {
+		return nil
+	}
+
+	n.mu.Lock()
+	writers := make([]*selfAttrHandle, 0, len(n.writers))
+	for h := range n.writers {
+		writers = append(writers, h)
+	}
+	n.mu.Unlock()
+
+	if len(writers) == 0 {
+		return n.set(n.self(), "")
+	}
+	for _, h := range writers {
+		h.mu.Lock()
+		h.dirty = true
+		h.mu.Unlock()
+	}
+	return nil
+}
+
+// selfAttrHandle collects what is written to a /self file, so that
+// a value split across several writes is applied once, whole.
+type selfAttrHandle struct {
+	n *selfAttrNode
+
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	dirty bool
+}
+
+func (h *selfAttrHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buf.Write(req.Data)
+	h.dirty = true
+	resp.Size = len(req.Data)
+	return nil
+}
+
+func (h *selfAttrHandle) ReadAll(ctx context.Context) ([]byte, error) {
+	return h.n.ReadAll(ctx)
+}
+
+// must be called with h.mu held
+func (h *selfAttrHandle) flush() error {
+	if !h.dirty {
+		return nil
+	}
+	h.dirty = false
+
+	val := strings.TrimSpace(h.buf.String())
+	h.buf.Reset()
+	return h.n.set(h.n.self(), val)
+}
+
+func (h *selfAttrHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flush()
+}
+
+func (h *selfAttrHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.n.mu.Lock()
+	delete(h.n.writers, h)
+	h.n.mu.Unlock()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flush()
+}
+
+func (n *selfAttrNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
+
+// refreshUser re-reads our own user's attributes, like presence,
+// after we've changed them.
+func (self *Self) refreshUser() {
+	if ud := self.conn.users.Dir(self.userId); ud != nil {
+		ud.UpdateChildren()
+	}
+}
+
+func getPresence(self *Self) (string, error) {
+	u := self.conn.users.Get(self.userId)
+	if u == nil {
+		return "", fuse.ENOENT
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.Presence + "\n", nil
+}
+
+func setPresence(self *Self, val string) error {
+	if val != "auto" && val != "away" {
+		return fuse.Errno(syscall.EINVAL)
+	}
+	api := self.conn.api
+	if api == nil {
+		// offline
+		return fuse.ENOSYS
+	}
+	if err := api.SetUserPresence(val); err != nil {
+		return apiErrno("SetUserPresence", err)
+	}
+
+	// we're connected, so 'auto' means active.  The
+	// presence_change event will confirm this shortly.
+	presence := "active"
+	if val == "away" {
+		presence = "away"
+	}
+	if u := self.conn.users.Get(self.userId); u != nil {
+		u.mu.Lock()
+		u.Presence = presence
+		u.mu.Unlock()
+	}
+	self.refreshUser()
+	return nil
+}
+
+type dndInfo struct {
+	DndEnabled     bool  `json:"dnd_enabled"`
+	NextDndStartTs int64 `json:"next_dnd_start_ts"`
+	NextDndEndTs   int64 `json:"next_dnd_end_ts"`
+	SnoozeEnabled  bool  `json:"snooze_enabled"`
+	SnoozeEndtime  int64 `json:"snooze_endtime"`
+}
+
+func getDnd(self *Self) (string, error) {
+	if self.conn.api == nil {
+		// offline
+		return "", fuse.ENOSYS
+	}
+	var info dndInfo
+	if err := self.conn.apiCall("dnd.info", nil, &info); err != nil {
+		return "", apiErrno("dnd.info", err)
+	}
+
+	loc := self.conn.displayLoc()
+	fmtTs := func(ts int64) string {
+		return time.Unix(ts, 0).In(loc).Format(time.RFC3339)
+	}
+
+	var val string
+	if info.SnoozeEnabled {
+		val += "snooze\tuntil " + fmtTs(info.SnoozeEndtime) + "\n"
+	} else {
+		val += "snooze\toff\n"
+	}
+	if info.DndEnabled {
+		val += "dnd\t" + fmtTs(info.NextDndStartTs) + " - " + fmtTs(info.NextDndEndTs) + "\n"
+	} else {
+		val += "dnd\toff\n"
+	}
+	return val, nil
+}
+
+// setDnd snoozes notifications for a duration like "30m" or "2h" (a
+// bare number is taken as minutes).  "off" ends both the snooze and
+// any scheduled DND period we are currently in.
+func setDnd(self *Self, val string) error {
+	if self.conn.api == nil {
+		// offline
+		return fuse.ENOSYS
+	}
+	if val == "off" {
+		if err := self.conn.apiCall("dnd.endSnooze", nil, nil); err != nil && err.Error() != "snooze_not_active" {
+			return apiErrno("dnd.endSnooze", err)
+		}
+		if err := self.conn.apiCall("dnd.endDnd", nil, nil); err != nil {
+			return apiErrno("dnd.endDnd", err)
+		}
+		self.refreshUser()
+		return nil
+	}
+
+	mins, err := parseDndMinutes(val)
+	if err != nil {
+		return err
+	}
+
+	args := url.Values{}
+	args.Set("num_minutes", strconv.Itoa(mins))
+	if err := self.conn.apiCall("dnd.setSnooze", args, nil); err != nil {
+		return apiErrno("dnd.setSnooze", err)
+	}
+	self.refreshUser()
+	return nil
+}
+
+// parseDndMinutes returns the length of a snooze in minutes.
+func parseDndMinutes(val string) (int, error) {
+	mins, err := strconv.Atoi(val)
+	if err != nil {
+		d, err := time.ParseDuration(val)
+		if err != nil || d < time.Minute {
+			return 0, fuse.Errno(syscall.EINVAL)
+		}
+		mins = int(d / time.Minute)
+	}
+	if mins <= 0 {
+		return 0, fuse.Errno(syscall.EINVAL)
+	}
+	return mins, nil
+}
+
+type statusProfile struct {
+	StatusText       string `json:"status_text"`
+	StatusEmoji      string `json:"status_emoji"`
+	StatusExpiration int64  `json:"status_expiration"`
+}
+
+func getStatus(self *Self) (string, error) {
+	if self.conn.api == nil {
+		// offline
+		return "", fuse.ENOSYS
+	}
+	var resp struct {
+		Profile statusProfile `json:"profile"`
+	}
+	if err := self.conn.apiCall("users.profile.get", nil, &resp); err != nil {
+		return "", apiErrno("users.profile.get", err)
+	}
+	p := resp.Profile
+
+	var fields []string
+	if p.StatusEmoji != "" {
+		fields = append(fields, p.StatusEmoji)
+	}
+	if p.StatusText != "" {
+		fields = append(fields, p.StatusText)
+	}
+	if p.StatusExpiration != 0 {
+		until := time.Unix(p.StatusExpiration, 0).In(self.conn.displayLoc())
+		fields = append(fields, "until "+until.Format(time.RFC3339))
+	}
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return strings.Join(fields, " ") + "\n", nil
+}
+
+// parseStatus splits a line like ":coffee: getting coffee +15m" into
+// its emoji, text and expiry.  The emoji and expiry are optional.
+func parseStatus(val string, now time.Time) (p statusProfile, err error) {
+	fields := strings.Fields(val)
+	if len(fields) > 0 {
+		f := fields[0]
+		if len(f) > 2 && strings.HasPrefix(f, ":") && strings.HasSuffix(f, ":") {
+			p.StatusEmoji = f
+			fields = fields[1:]
+		}
+	}
+	if len(fields) > 0 {
+		f := fields[len(fields)-1]
+		// something like "+1" is just text.
+		if d, err := time.ParseDuration(strings.TrimPrefix(f, "+")); strings.HasPrefix(f, "+") && err == nil {
+			if d <= 0 {
+				return p, fuse.Errno(syscall.EINVAL)
+			}
+			p.StatusExpiration = now.Add(d).Unix()
+			fields = fields[:len(fields)-1]
+		}
+	}
+	p.StatusText = strings.Join(fields, " ")
+	return p, nil
+}
+
+// setStatus sets our custom status.  An empty write clears it.
+func setStatus(self *Self, val string) error {
+	if self.conn.api == nil {
+		// offline
+		return fuse.ENOSYS
+	}
+	p, err := parseStatus(val, time.Now())
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(&p)
+	if err != nil {
+		log.Printf("Marshal(%#v): %s", p, err)
+		return fuse.EIO
+	}
+
+	args := url.Values{}
+	args.Set("profile", string(buf))
+	if err := self.conn.apiCall("users.profile.set", args, nil); err != nil {
+		return apiErrno("users.profile.set", err)
+	}
+	self.refreshUser()
+	return nil
+}
+
+// newSelfAttrs creates /self/presence, /self/dnd and /self/status.
+func newSelfAttrs(self *Self) error {
+	attrs := []struct {
+		name      string
+		get       func(*Self) (string, error)
+		set       func(*Self, string) error
+		clearable bool
+	}{
+		{"presence", getPresence, setPresence, false},
+		{"dnd", getDnd, setDnd, false},
+		{"status", getStatus, setStatus, true},
+	}
+	for _, a := range attrs {
+		n, err := newSelfAttr(self.dn, a.name, a.get, a.set)
+		if err != nil {
+			return fmt.Errorf("newSelfAttr(%s): %s", a.name, err)
+		}
+		n.clearable = a.clearable
+		n.Activate()
+	}
+	return nil
+}
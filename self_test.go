@@ -0,0 +1,74 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStatus(t *testing.T) {
+	now := time.Unix(1430744496, 0)
+	for _, tc := range []struct {
+		in  string
+		out statusProfile
+		ok  bool
+	}{
+		{"", statusProfile{}, true},
+		{"lunch", statusProfile{StatusText: "lunch"}, true},
+		{":coffee:", statusProfile{StatusEmoji: ":coffee:"}, true},
+		{":coffee: getting coffee", statusProfile{StatusText: "getting coffee", StatusEmoji: ":coffee:"}, true},
+		{":coffee: getting coffee +15m", statusProfile{"getting coffee", ":coffee:", now.Unix() + 15*60}, true},
+		{"in a meeting +1h30m", statusProfile{StatusText: "in a meeting", StatusExpiration: now.Unix() + 90*60}, true},
+		{"+2h", statusProfile{StatusExpiration: now.Unix() + 2*60*60}, true},
+		// not durations, so part of the text.
+		{"we're number +1", statusProfile{StatusText: "we're number +1"}, true},
+		{"back in 15m", statusProfile{StatusText: "back in 15m"}, true},
+		// '::' is too short to be an emoji.
+		{":: hi", statusProfile{StatusText: ":: hi"}, true},
+		{"  spaced   out  ", statusProfile{StatusText: "spaced out"}, true},
+		{"gone +0s", statusProfile{}, false},
+		{"gone +-5m", statusProfile{}, false},
+	} {
+		p, err := parseStatus(tc.in, now)
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("parseStatus(%q): err = %v, want ok = %v", tc.in, err, tc.ok)
+			continue
+		}
+		if tc.ok && p != tc.out {
+			t.Errorf("parseStatus(%q) = %#v, want %#v", tc.in, p, tc.out)
+		}
+	}
+}
+
+func TestParseDndMinutes(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		mins int
+		ok   bool
+	}{
+		{"30", 30, true},
+		{"1", 1, true},
+		{"30m", 30, true},
+		{"2h", 120, true},
+		{"1h30m", 90, true},
+		{"90s", 1, true},
+		{"0", 0, false},
+		{"-5", 0, false},
+		{"30s", 0, false},
+		{"-1h", 0, false},
+		{"", 0, false},
+		{"soon", 0, false},
+	} {
+		mins, err := parseDndMinutes(tc.in)
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("parseDndMinutes(%q): err = %v, want ok = %v", tc.in, err, tc.ok)
+			continue
+		}
+		if mins != tc.mins {
+			t.Errorf("parseDndMinutes(%q) = %d, want %d", tc.in, mins, tc.mins)
+		}
+	}
+}
@@ -8,14 +8,15 @@ import (
 	"bytes"
 	"fmt"
 	"log"
-	"math"
+	"net/url"
 	"sort"
-	"strconv"
+	"strings"
 	"sync"
 	"text/template"
 	"time"
 
 	"github.com/bpowers/fuse"
+	"github.com/bpowers/fuse/fs"
 	"github.com/bpowers/slack"
 	"golang.org/x/net/context"
 )
@@ -24,15 +25,11 @@ const (
 	// maximum history items we'll fetch at once
 	maxFetch = 1000
 
-	defaultMsgTmpl = "{{ts .Timestamp \"Jan 02 15:04:05\"}}\t{{username .}}\t{{fmt .Text}}\n"
+	defaultMsgTmpl = "{{ts .Timestamp \"Jan 02 15:04:05\"}}\t{{username .}}\t{{fmt .Text | highlight}}\n"
+	editedMsgTmpl  = "{{ts .Timestamp \"Jan 02 15:04:05\"}}\t{{username .}}\t(edited) {{fmt .Text | highlight}}\n"
+	deletedMsgTmpl = "{{ts .Timestamp \"Jan 02 15:04:05\"}}\t{{username .}}\t(deleted)\n"
 )
 
-type msgSlice []slack.Message
-
-func (p msgSlice) Len() int           { return len(p) }
-func (p msgSlice) Less(i, j int) bool { return p[i].Timestamp < p[j].Timestamp }
-func (p msgSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
-
 type HistoryFn func(id string, params slack.HistoryParameters) (*slack.History, error)
 
 type Session struct {
@@ -52,66 +49,229 @@ type Session struct {
 
 	acks map[int]struct{} // waiting for websocket acks
 
+	msgs    map[Timestamp]*RoomMsg
+	window  []msgEnd  // msgs, in the order they were formatted
+	trimmed Timestamp // newest message trimmed from the window
+	msgDir  *DirNode  // messages/, nil until created
+	cache   *MsgCache // nil if caching is disabled
+	started bool      // see Start
+
+	typing map[string]time.Time // user ID -> last user_typing event
+
 	// When any of the below are changed, Broadcast is called on
 	// cond.
 
 	initialized bool
-	formatted   bytes.Buffer
-	newestTs    string // most recent timestamp
+	pending     []*slack.Message // websocket messages waiting for initialized
+	formatted   *SpillBuffer
+	newestTs    Timestamp // most recent timestamp
 }
 
-func (s *Session) Init(room Room, conn *FSConn, history HistoryFn) {
-	s.L = &s.mu
-	s.history = history
-	s.room = room
-	s.id = room.Id()
-	s.conn = conn
-	s.acks = make(map[int]struct{})
+// msgEnd records where a message's formatted text ends in the
+// session, so that the message can be forgotten once that text has
+// been spilled out of the in-memory window.
+type msgEnd struct {
+	ts  Timestamp
+	m   *RoomMsg
+	end int64
+}
 
-	s.fns = template.FuncMap{
+// msgFuncs returns the functions available to message templates.
+func msgFuncs(conn *FSConn) template.FuncMap {
+	return template.FuncMap{
 		"username": func(msg *slack.Message) (string, error) {
-			u := s.conn.users.Get(msg.UserId)
+			u := conn.users.Get(msg.UserId)
 			if u == nil {
 				return fmt.Sprintf("<unknown|%s>", msg.UserId), nil
 			}
-			return u.Name, nil
+			return u.name(), nil
 		},
 		"ts": func(ts, layout string) (string, error) {
-			secs, err := strconv.ParseFloat(ts, 64)
+			t, err := ParseTimestamp(ts)
+			if err != nil {
+				// show what we got rather than
+				// failing the whole message.
+				log.Printf("ParseTimestamp: %s", err)
+				return ts, nil
+			}
+			return t.Time().In(conn.displayLoc()).Format(layout), nil
+		},
+		// usertz renders a message's timestamp in its author's
+		// timezone, rather than ours.
+		"usertz": func(msg *slack.Message, layout string) (string, error) {
+			t, err := ParseTimestamp(msg.Timestamp)
+			if err != nil {
+				log.Printf("ParseTimestamp: %s", err)
+				return msg.Timestamp, nil
+			}
+			loc := conn.displayLoc()
+			if u := conn.users.Get(msg.UserId); u != nil {
+				if userLoc := u.Location(); userLoc != nil {
+					loc = userLoc
+				}
+			}
+			return t.Time().In(loc).Format(layout), nil
+		},
+		"ago": func(ts string) (string, error) {
+			t, err := ParseTimestamp(ts)
 			if err != nil {
-				log.Panicf("ParseFloat(%s): %s", ts, err)
+				log.Printf("ParseTimestamp: %s", err)
 				return ts, nil
 			}
-			sec := int64(secs)
-			nsec := int64(1000000000 * (secs - math.Floor(secs)))
-			t := time.Unix(sec, nsec)
-			return t.Format(layout), nil
+			return relTime(t.Time(), time.Now()), nil
 		},
 		"fmt": func(txt string) (string, error) {
 			return txt, nil
 		},
+		"highlight": func(txt string) (string, error) {
+			return conn.highlight(txt), nil
+		},
+		// emoji renders standard :shortcodes: as Unicode,
+		// e.g. {{fmt .Text | emoji}}
+		"emoji": func(txt string) (string, error) {
+			return emojify(txt), nil
+		},
 	}
+}
 
-	// fetch session history in the background
-	if room.IsOpen() {
-		c := room.BaseChannel()
-		latestTs := c.Latest.Timestamp
-		n := c.UnreadCount + 100
-		if n > maxFetch {
-			n = maxFetch
+func (s *Session) Init(room Room, conn *FSConn, history HistoryFn) {
+	s.L = &s.mu
+	s.history = history
+	s.room = room
+	s.id = room.Id()
+	s.conn = conn
+	s.acks = make(map[int]struct{})
+	s.msgs = make(map[Timestamp]*RoomMsg)
+	s.typing = make(map[string]time.Time)
+	s.formatted = NewSpillBuffer(conn.opts.SessionWindow, conn.opts.SpillDir)
+
+	s.fns = msgFuncs(conn)
+
+	if !room.IsOpen() {
+		return
+	}
+	s.Start()
+}
+
+// Start loads the room's history, from the cache and then from
+// Slack.  Rooms we aren't in when we connect are started once they
+// are opened; Start is a no-op until the session is stopped.
+func (s *Session) Start() {
+	s.L.Lock()
+	started := s.started
+	s.started = true
+	if !started {
+		// readers wait for the history to be reloaded
+		// after a Stop.
+		s.initialized = false
+	}
+	s.L.Unlock()
+	if started {
+		return
+	}
+
+	conn := s.conn
+	if conn.opts.CacheDir != "" {
+		cache, err := OpenMsgCache(conn.opts.CacheDir, conn.team.Id, s.id)
+		if err != nil {
+			log.Printf("OpenMsgCache(%s): %s", s.id, err)
+		} else {
+			s.L.Lock()
+			s.cache = cache
+			s.L.Unlock()
 		}
+	}
+
+	// if we have history on disk, start with it and only fetch
+	// what we've missed since.
+	if s.cache != nil && s.loadCache() {
 		go s.FetchHistory(slack.HistoryParameters{
-			Latest:    latestTs,
-			Count:     n,
-			Inclusive: true,
+			Oldest: s.newestTs.String(),
+			Count:  maxFetch,
 		})
+		return
+	}
+
+	// fetch session history in the background
+	c := s.room.BaseChannel()
+	latestTs := c.Latest.Timestamp
+	n := c.UnreadCount + 100
+	if conn.opts.History > 0 {
+		n = conn.opts.History
+	}
+	if n > maxFetch {
+		n = maxFetch
+	}
+	go s.FetchHistory(slack.HistoryParameters{
+		Latest:    latestTs,
+		Count:     n,
+		Inclusive: true,
+	})
+}
+
+// Stop discards the session's history and closes its spill and
+// cache files, for when the room is hidden or the connection shut
+// down.  Starting the session again reloads its history.
+func (s *Session) Stop() {
+	s.L.Lock()
+	defer s.L.Unlock()
+
+	if !s.started {
+		return
 	}
+	s.started = false
+
+	if err := s.formatted.Close(); err != nil {
+		log.Printf("formatted.Close(%s): %s", s.id, err)
+	}
+	s.formatted = NewSpillBuffer(s.conn.opts.SessionWindow, s.conn.opts.SpillDir)
+	if s.cache != nil {
+		if err := s.cache.Close(); err != nil {
+			log.Printf("cache.Close(%s): %s", s.id, err)
+		}
+		s.cache = nil
+	}
+	s.msgs = make(map[Timestamp]*RoomMsg)
+	s.window = nil
+	s.trimmed = Timestamp{}
+	s.newestTs = Timestamp{}
+	s.pending = nil
+	// websocket messages are ignored until we're started again,
+	// and readers of the (now empty) session don't wait.
+	s.initialized = false
+	// the room's directory, and so messages/, is gone (or is
+	// about to be).
+	s.msgDir = nil
+	s.Broadcast()
+}
+
+// loadCache populates the session from the on-disk cache, returning
+// false if there was nothing there.
+func (s *Session) loadCache() bool {
+	// cached messages are JSON, several times the size of
+	// their formatted text; read about enough to fill the window.
+	msgs, err := s.cache.Load(4 * int64(s.conn.opts.SessionWindow))
+	if err != nil {
+		log.Printf("cache.Load(%s): %s", s.id, err)
+		return false
+	}
+	if len(msgs) == 0 {
+		return false
+	}
+
+	s.L.Lock()
+	defer s.L.Unlock()
+
+	s.appendMsgs(msgs, false)
+	s.setInitialized()
+
+	return true
 }
 
 func (s *Session) CurrLen() uint64 {
 	s.L.Lock()
 	defer s.L.Unlock()
-	for !s.initialized {
+	for s.started && !s.initialized {
 		s.Wait()
 	}
 	return uint64(s.formatted.Len())
@@ -120,17 +280,17 @@ func (s *Session) CurrLen() uint64 {
 func (s *Session) Bytes(offset int64, size int) ([]byte, error) {
 	s.L.Lock()
 	defer s.L.Unlock()
-	for !s.initialized {
+	for s.started && !s.initialized {
 		s.Wait()
 	}
-	bytes := s.formatted.Bytes()
-	if offset > int64(len(bytes)) {
+	if offset > s.formatted.Len() {
 		log.Printf("TODO: offset (%d) > bytes (%s)", offset, s.id)
 		return nil, fuse.EIO
 	}
-	bytes = bytes[offset:]
-	if len(bytes) > size {
-		bytes = bytes[:size]
+	bytes, err := s.formatted.Read(offset, size)
+	if err != nil {
+		log.Printf("formatted.Read(%s): %s", s.id, err)
+		return nil, fuse.EIO
 	}
 	return bytes, nil
 }
@@ -138,7 +298,12 @@ func (s *Session) Bytes(offset int64, size int) ([]byte, error) {
 func (s *Session) Write(msg []byte) error {
 	msg = bytes.TrimSpace(msg)
 	id := s.id
-	out := s.conn.ws.NewOutgoingMessage(string(msg), id)
+	ws := s.conn.websocket()
+	if ws == nil {
+		// offline, or between reconnects
+		return fuse.ENOSYS
+	}
+	out := ws.NewOutgoingMessage(string(msg), id)
 
 	// record our websocket-message ID so that we know what to do
 	// when the server acknowledges receipt
@@ -146,12 +311,25 @@ func (s *Session) Write(msg []byte) error {
 	s.acks[out.Id] = struct{}{}
 	s.L.Unlock()
 
-	err := s.conn.ws.SendMessage(out)
+	err := ws.SendMessage(out)
 	if err != nil {
 		log.Printf("SendMessage: %s", err)
+		s.L.Lock()
+		delete(s.acks, out.Id)
+		s.L.Unlock()
 	}
 
-	return nil
+	return err
+}
+
+// WriteMe sends msg as a /me style action.  The RTM API can't send
+// those, so this goes through the Web API; the message shows up in
+// the session when it is echoed back over the websocket.
+func (s *Session) WriteMe(msg []byte) error {
+	args := url.Values{}
+	args.Set("channel", s.id)
+	args.Set("text", string(msg))
+	return s.conn.apiCall("chat.meMessage", args, nil)
 }
 
 func (s *Session) Event(evt slack.SlackEvent) bool {
@@ -174,104 +352,359 @@ func (s *Session) Event(evt slack.SlackEvent) bool {
 		}
 		return true
 
+	case *slack.UserTypingEvent:
+		s.userTyping(msg.UserId)
+		return true
+
 	case *slack.MessageEvent:
 		if msg.ChannelId != s.id {
 			log.Printf("error: bad routing on %s for %#v", s.id, msg)
 			return false
 		}
-		s.addMessage((*slack.Message)(msg))
+		s.L.Lock()
+		defer s.L.Unlock()
+		switch {
+		case !s.started:
+			// the room is hidden; Start fetches what we
+			// missed when it is shown again.
+		case !s.initialized:
+			// don't add messages from the websocket until
+			// after we've initialized history.  Events are
+			// routed with the RoomSet unlocked, but we
+			// still mustn't block here.
+			s.pending = append(s.pending, (*slack.Message)(msg))
+		default:
+			s.applyMsg((*slack.Message)(msg))
+		}
 		return true
 	}
 
 	return false
 }
 
+// applyMsg records a message from the websocket in the session.
+//
+// must be called with s.L held
+func (s *Session) applyMsg(msg *slack.Message) {
+	switch msg.SubType {
+	case "message_changed":
+		if msg.SubMessage != nil {
+			s.changeMessage(msg.SubMessage)
+		}
+	case "message_deleted":
+		s.deleteMessage(msg.DeletedTimestamp)
+	default:
+		s.addMessage(msg)
+	}
+}
+
+// setInitialized marks the session's history as loaded, applies the
+// websocket messages that arrived while it was loading and wakes
+// any readers.
+//
+// must be called with s.L held
+func (s *Session) setInitialized() {
+	s.initialized = true
+	pending := s.pending
+	s.pending = nil
+	for _, msg := range pending {
+		s.applyMsg(msg)
+	}
+	s.Broadcast()
+}
+
 // must be called with s.L held
 func (s *Session) formatMsg(msg *slack.Message) error {
-	t := template.Must(template.New("msg").Funcs(s.fns).Parse(defaultMsgTmpl))
-	return t.Execute(&s.formatted, msg)
+	return s.formatWith(s.conn.templates().Msg, msg)
 }
 
-func (s *Session) FetchHistory(hp slack.HistoryParameters) error {
-	if hp.Oldest == "0000000000.000000" {
-		hp.Oldest = "0" // :(
+// must be called with s.L held
+func (s *Session) formatWith(tmpl string, msg *slack.Message) error {
+	if s.conn.ignored(msg.UserId) {
+		return nil
+	}
+	t := template.Must(template.New("msg").Funcs(s.fns).Parse(tmpl))
+	return t.Execute(s.formatted, msg)
+}
+
+// must be called with s.L held
+func (s *Session) recordMsg(ts Timestamp, msg *slack.Message) {
+	if _, ok := s.msgs[ts]; ok {
+		return
 	}
-	h, err := s.history(s.id, hp)
+	m := NewRoomMsg(*msg, s)
+	s.msgs[ts] = m
+	s.window = append(s.window, msgEnd{ts, m, s.formatted.Len()})
+	s.trimMsgs()
+	if _, ok := s.msgs[ts]; !ok {
+		// already older than the window
+		return
+	}
+
+	if s.msgDir == nil {
+		return
+	}
+	dir, err := NewMessageDir(s.msgDir, m)
 	if err != nil {
-		// FIXME: this is sort of gross - we need to log here
-		// becuase we call FetchHistory via `go` in Init()
-		// above, so there is noone to check the error.  We
-		// also need to ensure that initialized is true and we
-		// wake any waiters, otherwise stat/read/getdents
-		// syscalls will block uninterruptably.
-		err = fmt.Errorf("GetHistory(%s, %#v): %s", s.id, hp, err)
-		log.Printf("%s", err)
+		log.Printf("NewMessageDir(%s): %s", msg.Timestamp, err)
+		return
+	}
+	dir.Activate()
+}
 
-		s.L.Lock()
-		defer s.L.Unlock()
-		s.initialized = true
-		s.Broadcast()
+// trimMsgs forgets the messages whose formatted text has been
+// spilled out of the session window, along with their messages/
+// directories, so that memory use is bounded by SessionWindow rather
+// than growing for the life of the mount.
+//
+// must be called with s.L held
+func (s *Session) trimMsgs() {
+	spilled := s.formatted.Spilled()
+	if spilled == 0 {
+		return
+	}
+	i := 0
+	for ; i < len(s.window) && s.window[i].end <= spilled; i++ {
+		// the message may have been deleted (and even
+		// re-recorded) since.
+		e := s.window[i]
+		if s.msgs[e.ts] == e.m {
+			s.forgetMsg(e.ts)
+		}
+		if e.ts.After(s.trimmed) {
+			s.trimmed = e.ts
+		}
+	}
+	if i > 0 {
+		// copy, so the trimmed entries can be collected.
+		s.window = append([]msgEnd(nil), s.window[i:]...)
+	}
+}
+
+// setMsgDir is called when a room's messages/ directory is created,
+// and populates it with every message we know about.
+func (s *Session) setMsgDir(dn *DirNode) {
+	s.L.Lock()
+	defer s.L.Unlock()
 
-		return err
+	s.msgDir = dn
+	dn.SetMaker(msgDirMaker{s})
+
+	tss := make([]Timestamp, 0, len(s.msgs))
+	for ts := range s.msgs {
+		tss = append(tss, ts)
 	}
+	sort.Sort(tsSlice(tss))
+	for _, ts := range tss {
+		dir, err := NewMessageDir(dn, s.msgs[ts])
+		if err != nil {
+			log.Printf("NewMessageDir(%s): %s", ts, err)
+			continue
+		}
+		dir.Activate()
+	}
+}
 
-	if h.HasMore && len(h.Messages) == maxFetch {
-		log.Printf("TODO: %s/%s has more (%#v).", s.room.Id(), s.room.Name(), hp)
+// FetchHistory fetches messages from Slack and adds them to the
+// session.  When hp has an Oldest timestamp (when catching up after
+// loading the cache, say), we want everything since then, so pages
+// are fetched until there are no more: missing a page would leave a
+// permanent gap in the cache.  Otherwise only one page is fetched.
+func (s *Session) FetchHistory(hp slack.HistoryParameters) error {
+	// the API rejects a zero-padded zero timestamp
+	if ts, err := ParseTimestamp(hp.Oldest); err == nil && ts.IsZero() {
+		hp.Oldest = "0"
 	}
+	var msgs []slack.Message
+	for {
+		h, err := s.history(s.id, hp)
+		if err != nil {
+			// FIXME: this is sort of gross - we need to log here
+			// becuase we call FetchHistory via `go` in Init()
+			// above, so there is noone to check the error.  We
+			// also need to ensure that initialized is true and we
+			// wake any waiters, otherwise stat/read/getdents
+			// syscalls will block uninterruptably.
+			// the slack package's errors can include the request
+			// URL, token and all.
+			err = fmt.Errorf("GetHistory(%s, %#v): %s", s.id, hp, Redact(err.Error()))
+			log.Printf("%s", err)
+
+			s.L.Lock()
+			defer s.L.Unlock()
+			if s.started {
+				s.setInitialized()
+			}
 
-	sort.Sort(msgSlice(h.Messages))
+			return err
+		}
+		msgs = append(msgs, h.Messages...)
 
-	lastReadTs := s.room.BaseChannel().LastRead
+		if !h.HasMore || len(h.Messages) == 0 {
+			break
+		}
+		if hp.Oldest == "" {
+			if len(h.Messages) == maxFetch {
+				log.Printf("TODO: %s/%s has more (%#v).", s.room.Id(), s.room.Name(), hp)
+			}
+			break
+		}
+		// pages run newest first, so the next one ends
+		// where this one began.
+		sortMsgs(h.Messages)
+		hp.Latest = h.Messages[0].Timestamp
+		hp.Inclusive = false
+	}
+
+	sortMsgs(msgs)
 
 	s.L.Lock()
 	defer s.L.Unlock()
 
-	for _, msg := range h.Messages {
-		err := s.formatMsg(&msg)
+	if !s.started {
+		// stopped while we were fetching; Start fetches
+		// again.
+		return nil
+	}
+	s.appendMsgs(msgs, true)
+	s.setInitialized()
+
+	return nil
+}
+
+// appendMsgs formats and records a sorted slice of messages, skipping
+// any we already know about.  If persist is true, new messages are
+// also written to the cache.
+//
+// must be called with s.L held
+func (s *Session) appendMsgs(msgs []slack.Message, persist bool) {
+	lastReadTs := s.room.BaseChannel().LastRead
+
+	for _, msg := range msgs {
+		ts, err := ParseTimestamp(msg.Timestamp)
+		if err != nil {
+			// we couldn't key or order it.
+			log.Printf("%s: dropping message: %s", s.id, err)
+			continue
+		}
+		// known, or already shown and trimmed
+		if _, ok := s.msgs[ts]; ok || !ts.After(s.trimmed) {
+			continue
+		}
+		err = s.formatMsg(&msg)
 		if err != nil {
 			log.Printf("formatMsg(%#v): %s", msg, err)
 		}
+		s.recordMsg(ts, &msg)
+		if persist {
+			s.persist(&msg)
+		}
 		if !s.initialized && msg.Timestamp == lastReadTs {
 			s.formatted.WriteString("# current session begins here\n")
 		}
+		s.advanceNewest(ts)
 	}
-	if len(h.Messages) > 0 {
-		s.newestTs = h.Messages[len(h.Messages)-1].Timestamp
-	} else {
-		s.newestTs = "0000000000.000000"
+}
+
+// advanceNewest records ts as the newest timestamp we've seen, if it
+// is.
+//
+// must be called with s.L held
+func (s *Session) advanceNewest(ts Timestamp) {
+	if ts.After(s.newestTs) {
+		s.newestTs = ts
 	}
-	s.initialized = true
-	s.Broadcast()
+}
 
-	return nil
+// persist appends msg to the on-disk cache, if there is one.
+func (s *Session) persist(msg *slack.Message) {
+	if s.cache == nil {
+		return
+	}
+	if err := s.cache.Append(msg); err != nil {
+		log.Printf("cache.Append(%s): %s", s.id, err)
+	}
 }
 
+// must be called with s.L held
 func (s *Session) addMessage(msg *slack.Message) error {
-	s.L.Lock()
-	defer s.L.Unlock()
-	// don't add messages from the websocket until after we've
-	// initialized history.
-	for !s.initialized {
-		log.Printf("waiting to init before recording msg %s", msg.Text)
-		s.Wait()
+	ts, err := ParseTimestamp(msg.Timestamp)
+	if err != nil {
+		log.Printf("dropping WS message (%s): %s", msg.Text, err)
+		return nil
 	}
-	if msg.Timestamp <= s.newestTs {
+	if !ts.After(s.newestTs) {
 		log.Printf("dropping WS message %s (%s) because it is too old", msg.Timestamp, msg.Text)
 		return nil
 	}
 
-	err := s.formatMsg(msg)
+	err = s.formatMsg(msg)
 	if err != nil {
 		log.Printf("formatMsg(%#v): %s", msg, err)
 		return nil
 	}
-	s.newestTs = msg.Timestamp
+	s.recordMsg(ts, msg)
+	s.persist(msg)
+	s.advanceNewest(ts)
+	// sending a message means you're done typing it.
+	delete(s.typing, msg.UserId)
 
 	s.Broadcast()
 
 	return nil
 }
 
+// changeMessage handles a message_changed event.  The session is
+// append-only (so that `tail -f` keeps working), so rather than
+// rewriting history the edit is recorded as a new line.
+//
+// must be called with s.L held
+func (s *Session) changeMessage(sub *slack.Msg) {
+
+	if ts, err := ParseTimestamp(sub.Timestamp); err != nil {
+		log.Printf("message_changed: %s", err)
+	} else if m, ok := s.msgs[ts]; ok {
+		m.setText(sub.Text, sub.Edited)
+		updated := m.Get()
+		s.persist(&updated)
+	}
+
+	msg := slack.Message{Msg: *sub}
+	if err := s.formatWith(s.conn.templates().Edited, &msg); err != nil {
+		log.Printf("formatWith(%#v): %s", msg, err)
+		return
+	}
+	s.Broadcast()
+}
+
+// deleteMessage handles a message_deleted event.
+//
+// must be called with s.L held
+func (s *Session) deleteMessage(ts string) {
+
+	msg := slack.Message{}
+	msg.Timestamp = ts
+	if t, err := ParseTimestamp(ts); err != nil {
+		log.Printf("message_deleted: %s", err)
+	} else {
+		if m, ok := s.msgs[t]; ok {
+			msg = m.Get()
+		}
+		s.forgetMsg(t)
+	}
+	if s.cache != nil {
+		if err := s.cache.AppendDeleted(ts); err != nil {
+			log.Printf("cache.AppendDeleted(%s): %s", s.id, err)
+		}
+	}
+
+	if err := s.formatWith(s.conn.templates().Deleted, &msg); err != nil {
+		log.Printf("formatWith(%#v): %s", msg, err)
+		return
+	}
+	s.Broadcast()
+}
+
 func newSession(parent *DirNode) (INode, error) {
 	name := "session"
 	n := new(SessionAttrNode)
@@ -305,6 +738,8 @@ type SessionProvider interface {
 
 type SessionWriter interface {
 	Write([]byte) error
+	WriteMe([]byte) error
+	Typing() error
 }
 
 type SessionAttrNode struct {
@@ -338,35 +773,65 @@ func (an *SessionAttrNode) Read(ctx context.Context, req *fuse.ReadRequest, resp
 	return nil
 }
 
+// msgFilter transforms the text written to a write file into the
+// message that is sent.
+type msgFilter func(msg []byte) []byte
+
 type sessionWriteNode struct {
 	AttrNode
+
+	// In line mode every complete line is sent as a message as
+	// soon as it is written, for interactive use like `cat >
+	// write.line`.  Otherwise, everything written through a file
+	// handle is sent as a single message when it is closed.
+	lineMode bool
+	filter   msgFilter
+	me       bool // send as a me_message
+}
+
+func newSessionWriteAttr(name string, lineMode bool, filter msgFilter) AttrFactory {
+	return func(parent *DirNode) (INode, error) {
+		return newSessionWriteNode(parent, name, lineMode, filter)
+	}
 }
 
-func newSessionWrite(parent *DirNode) (INode, error) {
-	name := "write"
+func newSessionWriteNode(parent *DirNode, name string, lineMode bool, filter msgFilter) (*sessionWriteNode, error) {
 	n := new(sessionWriteNode)
 	if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
 		return nil, fmt.Errorf("node.Init('%s': %s", name, err)
 	}
+	n.lineMode = lineMode
+	n.filter = filter
 	n.Update()
 	n.mode = 0222
 	return n, nil
 }
 
+func newSessionWriteMe(parent *DirNode) (INode, error) {
+	n, err := newSessionWriteNode(parent, "write.me", false, nil)
+	if err != nil {
+		return nil, err
+	}
+	n.me = true
+	return n, nil
+}
+
 func (n *sessionWriteNode) Update() {
 }
 
-func (n *sessionWriteNode) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
-	g, ok := n.parent.priv.(SessionWriter)
+func (n *sessionWriteNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	w, ok := n.parent.priv.(SessionWriter)
 	if !ok {
 		log.Printf("priv is not SessionWriter")
-		return fuse.ENOSYS
+		return nil, fuse.ENOSYS
 	}
 
-	g.Write(req.Data)
-	resp.Size = len(req.Data)
-
-	return nil
+	h := new(sessionWriteHandle)
+	h.n = n
+	h.w = w
+	h.done = make(chan struct{})
+	go h.keepTyping()
+	return h, nil
 }
 
 func (n *sessionWriteNode) Activate() error {
@@ -377,46 +842,234 @@ func (n *sessionWriteNode) Activate() error {
 	return n.parent.addChild(n)
 }
 
-type sessionWritePreNode struct {
-	AttrNode
+// sessionWriteHandle buffers writes to an open write file.
+type sessionWriteHandle struct {
+	n *sessionWriteNode
+	w SessionWriter
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	typing typingState
+	done   chan struct{} // closed on Release
 }
 
-func newSessionWritePre(parent *DirNode) (INode, error) {
-	name := "write.pre"
-	n := new(sessionWritePreNode)
-	if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
-		return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+// keepTyping sends typing events while the handle is being written
+// to, until it is released.
+func (h *sessionWriteHandle) keepTyping() {
+	ticker := time.NewTicker(typingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			h.mu.Lock()
+			due := h.typing.due(now)
+			h.mu.Unlock()
+			if due {
+				h.w.Typing()
+			}
+		case <-h.done:
+			return
+		}
 	}
-	n.Update()
-	n.mode = 0222
-	return n, nil
 }
 
-func (n *sessionWritePreNode) Update() {
-}
+func (h *sessionWriteHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-var escBytes = []byte("```")
+	now := time.Now()
+	h.typing.wrote(now)
+	if h.typing.due(now) {
+		h.w.Typing()
+	}
+	h.buf.Write(req.Data)
+	resp.Size = len(req.Data)
 
-func (n *sessionWritePreNode) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
-	g, ok := n.parent.priv.(SessionWriter)
-	if !ok {
-		log.Printf("priv is not SessionWriter")
-		return fuse.ENOSYS
+	if !h.n.lineMode {
+		return nil
+	}
+	for {
+		i := bytes.IndexByte(h.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		if err := h.send(h.buf.Next(i + 1)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// must be called with h.mu held
+func (h *sessionWriteHandle) send(msg []byte) error {
+	// preserve leading indentation (which matters for
+	// write.pre), but drop surrounding blank lines.
+	msg = bytes.TrimLeft(msg, "\r\n")
+	msg = bytes.TrimRight(msg, " \t\r\n")
+	if len(msg) == 0 {
+		return nil
 	}
+	if h.n.filter != nil {
+		msg = h.n.filter(msg)
+	}
+	write := h.w.Write
+	if h.n.me {
+		write = h.w.WriteMe
+	}
+	if err := write(msg); err != nil {
+		log.Printf("Write(%s): %s", h.n.name, err)
+		return fuse.EIO
+	}
+	return nil
+}
 
-	msgIn := bytes.TrimSpace(req.Data)
+// must be called with h.mu held
+func (h *sessionWriteHandle) flush() error {
+	err := h.send(h.buf.Bytes())
+	h.buf.Reset()
+	return err
+}
+
+// Flush is called on every close(2) of the handle, so that errors
+// sending the message are reported to the writer.
+func (h *sessionWriteHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flush()
+}
+
+func (h *sessionWriteHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	close(h.done)
+	return h.flush()
+}
+
+var (
+	escBytes   = []byte("```")
+	quoteBytes = []byte("> ")
+)
+
+// fencePre wraps msg in triple-backticks, so that it is displayed
+// preformatted.
+func fencePre(msgIn []byte) []byte {
 	msg := make([]byte, len(msgIn)+6)
 	copy(msg, escBytes)
 	copy(msg[3:], msgIn)
 	copy(msg[3+len(msgIn):], escBytes)
+	return msg
+}
 
-	g.Write(msg)
-	resp.Size = len(req.Data)
+// fenceLang returns a filter that fences text like fencePre, but
+// with a language hint after the opening backticks.
+func fenceLang(lang string) msgFilter {
+	return func(msgIn []byte) []byte {
+		var msg bytes.Buffer
+		msg.Write(escBytes)
+		msg.WriteString(lang)
+		msg.WriteByte('\n')
+		msg.Write(msgIn)
+		msg.WriteByte('\n')
+		msg.Write(escBytes)
+		return msg.Bytes()
+	}
+}
 
-	return nil
+// quote prefixes every line of msg with '> '.
+func quote(msgIn []byte) []byte {
+	lines := bytes.Split(msgIn, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = append(append([]byte{}, quoteBytes...), line...)
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// languages we create write.code/ files for up front, so that they
+// show up in a directory listing.  Any other name can be opened for
+// writing too, and is added to the directory then.
+var codeLangs = []string{"go", "sh", "python", "json", "diff", "c", "js"}
+
+// codeDirNode is the write.code/ directory: each file in it fences
+// what is written with the file's name as the language.
+type codeDirNode struct {
+	DirNode
+}
+
+func newCodeDir(parent *DirNode) (INode, error) {
+	n := new(codeDirNode)
+	if err := n.DirNode.Init(parent, "write.code", parent.priv); err != nil {
+		return nil, fmt.Errorf("DirNode.Init(write.code): %s", err)
+	}
+	for _, lang := range codeLangs {
+		child, err := newSessionWriteNode(&n.DirNode, lang, false, fenceLang(lang))
+		if err != nil {
+			return nil, fmt.Errorf("newSessionWriteNode(%s): %s", lang, err)
+		}
+		n.keep(child)
+	}
+	return n, nil
+}
+
+// keep adds child to the directory, unless a file with its name was
+// added first, and returns whichever is now in the directory.
+func (n *codeDirNode) keep(child INode) INode {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if existing, ok := n.childmap[child.Name()]; ok {
+		return existing
+	}
+	n.childmap[child.Name()] = child
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *codeDirNode) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	// don't litter the directory with editor and shell probes.
+	if strings.HasPrefix(name, ".") {
+		return nil, fuse.ENOENT
+	}
+
+	n.mu.Lock()
+	child, ok := n.childmap[name]
+	n.mu.Unlock()
+	if ok {
+		return child, nil
+	}
+
+	w, err := newSessionWriteNode(&n.DirNode, name, false, fenceLang(name))
+	if err != nil {
+		log.Printf("newSessionWriteNode(%s): %s", name, err)
+		return nil, fuse.ENOENT
+	}
+	return &codeLangNode{w, n}, nil
+}
+
+// codeLangNode is a write.code/ file for a language not in
+// codeLangs.  It only becomes part of the directory once opened for
+// writing, so that a stat or a failed open doesn't leave an entry
+// behind.
+type codeLangNode struct {
+	*sessionWriteNode
+	dir *codeDirNode
+}
+
+func (n *codeLangNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if req.Flags.IsReadOnly() {
+		return nil, fuse.EPERM
+	}
+	h, err := n.sessionWriteNode.Open(ctx, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	n.dir.keep(n.sessionWriteNode)
+	return h, nil
 }
 
-func (n *sessionWritePreNode) Activate() error {
+func (n *codeDirNode) Activate() error {
 	if n.parent == nil {
 		return nil
 	}
@@ -428,7 +1081,14 @@ func (n *sessionWritePreNode) Activate() error {
 // has os.NamedPipe the writer (bash) hangs on an open() that we never
 // get a fuse request for.
 var roomAttrs = []AttrFactory{
-	newSessionWrite,
-	newSessionWritePre,
+	newSessionWriteAttr("write", false, nil),
+	newSessionWriteAttr("write.line", true, nil),
+	newSessionWriteAttr("write.pre", false, fencePre),
+	newSessionWriteAttr("write.quote", false, quote),
+	newSessionWriteMe,
+	newCodeDir,
 	newSession,
+	newRoomCtl,
+	newMessages,
+	newTyping,
 }
@@ -0,0 +1,40 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"testing"
+)
+
+func TestMsgFilters(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		filter msgFilter
+		in     string
+		out    string
+	}{
+		{"quote", quote, "hi", "> hi"},
+		{"quote", quote, "a\nb", "> a\n> b"},
+		{"quote", quote, "a\n\nb", "> a\n> \n> b"},
+		{"quote", quote, "", "> "},
+		{"fencePre", fencePre, "x := 1", "```x := 1```"},
+		{"fencePre", fencePre, "a\n  b", "```a\n  b```"},
+		{"fencePre", fencePre, "", "``````"},
+		{"fenceLang(go)", fenceLang("go"), "x := 1", "```go\nx := 1\n```"},
+		{"fenceLang(sh)", fenceLang("sh"), "ls\npwd", "```sh\nls\npwd\n```"},
+	} {
+		if out := string(tc.filter([]byte(tc.in))); out != tc.out {
+			t.Errorf("%s(%q) = %q, want %q", tc.name, tc.in, out, tc.out)
+		}
+	}
+}
+
+func TestQuoteDoesNotModifyInput(t *testing.T) {
+	in := []byte("a\nb")
+	quote(in)
+	if string(in) != "a\nb" {
+		t.Errorf("quote modified its input: %q", in)
+	}
+}
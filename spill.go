@@ -0,0 +1,125 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// SpillBuffer is an append-only byte buffer that keeps at most
+// window bytes in memory.  Older bytes are moved to an (unlinked)
+// segment file on disk, but remain readable at their original
+// offsets.  A window of 0 means unbounded, in which case
+// SpillBuffer behaves like a bytes.Buffer that is never read from.
+//
+// SpillBuffer isn't safe for concurrent use; Session guards it with
+// Session.L.
+type SpillBuffer struct {
+	window int
+	dir    string // where the segment file is created
+
+	mem     []byte   // bytes [spilled, spilled+len(mem))
+	spilled int64    // number of bytes in f
+	f       *os.File // nil until we first spill
+}
+
+func NewSpillBuffer(window int, dir string) *SpillBuffer {
+	b := new(SpillBuffer)
+	b.window = window
+	b.dir = dir
+
+	return b
+}
+
+// Spilled returns the number of bytes that have been moved to disk;
+// every offset below it has left the in-memory window.
+func (b *SpillBuffer) Spilled() int64 {
+	return b.spilled
+}
+
+// Len returns the total number of bytes written.
+func (b *SpillBuffer) Len() int64 {
+	return b.spilled + int64(len(b.mem))
+}
+
+func (b *SpillBuffer) Write(p []byte) (int, error) {
+	b.mem = append(b.mem, p...)
+	if b.window > 0 && len(b.mem) > b.window {
+		b.spill()
+	}
+	return len(p), nil
+}
+
+func (b *SpillBuffer) WriteString(s string) (int, error) {
+	return b.Write([]byte(s))
+}
+
+// spill moves the oldest bytes to disk, leaving half a window in
+// memory so that we don't have to spill on every write.  On failure
+// everything stays in memory; we'd rather use too much RAM than
+// lose history.
+func (b *SpillBuffer) spill() {
+	if b.f == nil {
+		f, err := ioutil.TempFile(b.dir, "slackfs-session-")
+		if err != nil {
+			log.Printf("TempFile(%s): %s", b.dir, err)
+			return
+		}
+		// the file lives as long as we hold it open.
+		os.Remove(f.Name())
+		b.f = f
+	}
+
+	n := len(b.mem) - b.window/2
+	if _, err := b.f.WriteAt(b.mem[:n], b.spilled); err != nil {
+		log.Printf("spill WriteAt(%d): %s", b.spilled, err)
+		return
+	}
+	b.spilled += int64(n)
+	b.mem = append([]byte(nil), b.mem[n:]...)
+}
+
+// Read returns up to size bytes starting at offset.
+func (b *SpillBuffer) Read(offset int64, size int) ([]byte, error) {
+	if offset > b.Len() {
+		return nil, fmt.Errorf("offset %d past end (%d)", offset, b.Len())
+	}
+	if rest := b.Len() - offset; int64(size) > rest {
+		size = int(rest)
+	}
+	buf := make([]byte, 0, size)
+
+	if offset < b.spilled {
+		n := size
+		if fromDisk := b.spilled - offset; int64(n) > fromDisk {
+			n = int(fromDisk)
+		}
+		disk := make([]byte, n)
+		if _, err := b.f.ReadAt(disk, offset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("ReadAt(%d): %s", offset, err)
+		}
+		buf = append(buf, disk...)
+		offset += int64(n)
+		size -= n
+	}
+	if size > 0 {
+		start := offset - b.spilled
+		buf = append(buf, b.mem[start:start+int64(size)]...)
+	}
+
+	return buf, nil
+}
+
+// Close releases the segment file, if any.
+func (b *SpillBuffer) Close() error {
+	if b.f == nil {
+		return nil
+	}
+	return b.f.Close()
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpillBufferRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slackfs-spill-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var all bytes.Buffer
+	b := NewSpillBuffer(16, dir)
+	defer b.Close()
+	for _, s := range []string{"0123456789", "abcdefghij", "ABCDEFGHIJ", "klmnopqrst"} {
+		b.WriteString(s)
+		all.WriteString(s)
+	}
+	if b.Spilled() == 0 {
+		t.Fatalf("nothing spilled")
+	}
+	if b.Len() != int64(all.Len()) {
+		t.Fatalf("Len() = %d, want %d", b.Len(), all.Len())
+	}
+
+	spilled := b.Spilled()
+	for _, tc := range []struct {
+		name   string
+		offset int64
+		size   int
+	}{
+		{"all", 0, all.Len()},
+		{"disk only", 0, int(spilled)},
+		{"memory only", spilled, int(b.Len() - spilled)},
+		{"across boundary", spilled - 3, 6},
+		{"ending at boundary", spilled - 5, 5},
+		{"starting at boundary", spilled, 3},
+		{"past end", spilled - 2, 1000},
+		{"at end", b.Len(), 10},
+		{"empty", 4, 0},
+	} {
+		got, err := b.Read(tc.offset, tc.size)
+		if err != nil {
+			t.Errorf("%s: Read(%d, %d): %s", tc.name, tc.offset, tc.size, err)
+			continue
+		}
+		end := tc.offset + int64(tc.size)
+		if end > int64(all.Len()) {
+			end = int64(all.Len())
+		}
+		if want := all.Bytes()[tc.offset:end]; !bytes.Equal(got, want) {
+			t.Errorf("%s: Read(%d, %d) = %q, want %q", tc.name, tc.offset, tc.size, got, want)
+		}
+	}
+
+	if _, err := b.Read(b.Len()+1, 1); err == nil {
+		t.Errorf("Read past the end succeeded")
+	}
+}
+
+func TestSpillBufferUnbounded(t *testing.T) {
+	b := NewSpillBuffer(0, "")
+	defer b.Close()
+	for i := 0; i < 100; i++ {
+		b.WriteString("0123456789")
+	}
+	if b.Spilled() != 0 {
+		t.Errorf("unbounded buffer spilled %d bytes", b.Spilled())
+	}
+	got, err := b.Read(995, 10)
+	if err != nil || string(got) != "56789" {
+		t.Errorf("Read(995, 10) = %q, %v", got, err)
+	}
+}
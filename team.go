@@ -5,7 +5,9 @@
 package slackfs
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"sync"
 
 	"github.com/bpowers/slack"
@@ -15,6 +17,17 @@ type Team struct {
 	slack.Team
 	mu   sync.Mutex
 	conn *FSConn
+	dir  *DirNode
+
+	// not carried by the slack package's Team.  Offline, Plan
+	// and Prefs come from the raw rtm.start response.  Online,
+	// EmailDomain, Icon and Plan come from team.info and Prefs
+	// from team.preferences.list, kept current by
+	// team_pref_change.
+	EmailDomain string
+	Icon        map[string]interface{}
+	Plan        string
+	Prefs       map[string]interface{}
 }
 
 func NewTeam(st *slack.Team, conn *FSConn) *Team {
@@ -25,6 +38,123 @@ func NewTeam(st *slack.Team, conn *FSConn) *Team {
 	return t
 }
 
+// rtmTeam is the part of a raw rtm.start response the slack
+// package's Team doesn't parse.
+type rtmTeam struct {
+	Team struct {
+		Plan  string                 `json:"plan"`
+		Prefs map[string]interface{} `json:"prefs"`
+	} `json:"team"`
+}
+
+// Refresh fills in the details of the team not present in the
+// rtm.start response.
+func (t *Team) Refresh() error {
+	if t.conn.api == nil {
+		return nil
+	}
+
+	var resp struct {
+		Team struct {
+			Name        string                 `json:"name"`
+			Domain      string                 `json:"domain"`
+			EmailDomain string                 `json:"email_domain"`
+			Icon        map[string]interface{} `json:"icon"`
+			Plan        string                 `json:"plan"`
+		} `json:"team"`
+	}
+	if err := t.conn.apiCall("team.info", nil, &resp); err != nil {
+		return fmt.Errorf("team.info: %s", err)
+	}
+
+	// team.preferences.list needs a scope not every token
+	// has, so carry on without prefs if it fails.
+	prefs, err := t.fetchPrefs()
+	if err != nil {
+		log.Printf("team.preferences.list: %s", err)
+	}
+
+	t.mu.Lock()
+	t.Name = resp.Team.Name
+	t.Domain = resp.Team.Domain
+	t.EmailDomain = resp.Team.EmailDomain
+	t.Icon = resp.Team.Icon
+	if resp.Team.Plan != "" {
+		t.Plan = resp.Team.Plan
+	}
+	if prefs != nil {
+		t.Prefs = prefs
+	}
+	t.mu.Unlock()
+
+	if t.dir != nil {
+		t.dir.UpdateChildren()
+	}
+	return nil
+}
+
+// fetchPrefs returns the team's preferences, which
+// team.preferences.list returns as top-level fields of its
+// response.
+func (t *Team) fetchPrefs() (map[string]interface{}, error) {
+	var prefs map[string]interface{}
+	if err := t.conn.apiCall("team.preferences.list", nil, &prefs); err != nil {
+		return nil, err
+	}
+	for _, k := range []string{"ok", "warning", "response_metadata"} {
+		delete(prefs, k)
+	}
+	return prefs, nil
+}
+
+func (t *Team) Event(evt slack.SlackEvent) bool {
+	t.mu.Lock()
+	switch msg := evt.Data.(type) {
+	case *slack.TeamRenameEvent:
+		t.Name = msg.Name
+	case *slack.TeamDomainChangeEvent:
+		t.Domain = msg.Domain
+	case *slack.TeamPrefChangeEvent:
+		if t.Prefs == nil {
+			t.Prefs = make(map[string]interface{})
+		}
+		t.Prefs[msg.Name] = msg.Value
+	default:
+		t.mu.Unlock()
+		return false
+	}
+	t.mu.Unlock()
+
+	if msg, ok := evt.Data.(*slack.TeamDomainChangeEvent); ok {
+		// when serving several teams, each is linked to
+		// from teams/$domain.
+		if p := t.conn.root.Parent(); p != nil {
+			if ts, ok := p.priv.(*Teams); ok {
+				ts.Rename(t.conn, msg.Domain)
+			}
+		}
+	}
+
+	if t.dir != nil {
+		t.dir.UpdateChildren()
+	}
+	return true
+}
+
+// iconURL returns the URL of the team's icon, preferring the
+// largest fixed size.
+func (t *Team) iconURL() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, size := range []string{"image_132", "image_102", "image_88", "image_68"} {
+		if url, ok := t.Icon[size].(string); ok && url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
 type teamIdNode struct {
 	AttrNode
 }
@@ -61,17 +191,84 @@ func newTeamName(parent *DirNode) (INode, error) {
 }
 
 func (n *teamNameNode) Update() {
-	val := n.parent.priv.(*Team).Name + "\n"
+	t := n.parent.priv.(*Team)
+	t.mu.Lock()
+	val := t.Name + "\n"
+	t.mu.Unlock()
+	n.updateCommon(val)
+}
+
+type teamAttrNode struct {
+	AttrNode
+	val func(t *Team) string
+}
+
+// newTeamAttr returns a factory for a read-only attribute whose
+// contents are derived from the parent directory's Team.  val is
+// called with the Team's lock held.
+func newTeamAttr(name string, val func(t *Team) string) AttrFactory {
+	return func(parent *DirNode) (INode, error) {
+		n := new(teamAttrNode)
+		if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+			return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+		}
+		n.val = val
+		n.Update()
+		n.mode = 0444
+		return n, nil
+	}
+}
+
+func (n *teamAttrNode) Update() {
+	t := n.parent.priv.(*Team)
+	t.mu.Lock()
+	val := n.val(t)
+	t.mu.Unlock()
 	n.updateCommon(val)
 }
 
+func (n *teamAttrNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
+
+func newTeamIcon(parent *DirNode) (INode, error) {
+	t := parent.priv.(*Team)
+	cachePath := func(url string) string {
+		return t.conn.cacheFile("team", "icon", url, ".png")
+	}
+	return newRemoteNode(parent, "icon.png", t.iconURL, cachePath)
+}
+
+func teamPrefsJSON(t *Team) string {
+	prefs := t.Prefs
+	if prefs == nil {
+		prefs = map[string]interface{}{}
+	}
+	buf, err := json.MarshalIndent(prefs, "", "    ")
+	if err != nil {
+		log.Printf("MarshalIndent(prefs): %s", err)
+		return ""
+	}
+	return string(buf) + "\n"
+}
+
 var teamAttrs = []AttrFactory{
 	newTeamId,
 	newTeamName,
+	newTeamAttr("domain", func(t *Team) string { return t.Domain + "\n" }),
+	newTeamAttr("email-domain", func(t *Team) string { return t.EmailDomain + "\n" }),
+	newTeamIcon,
+	newTeamAttr("plan", func(t *Team) string { return t.Plan + "\n" }),
+	newTeamAttr("prefs.json", teamPrefsJSON),
 }
 
 func NewTeamDir(parent *DirNode, id string, priv interface{}) (*DirNode, error) {
-	if _, ok := priv.(*Team); !ok {
+	t, ok := priv.(*Team)
+	if !ok {
 		return nil, fmt.Errorf("NewTeamDir called w non-team: %#v", priv)
 	}
 
@@ -87,6 +284,7 @@ func NewTeamDir(parent *DirNode, id string, priv interface{}) (*DirNode, error)
 		}
 		dir.addChild(n)
 	}
+	t.dir = dir
 
 	return dir, nil
 }
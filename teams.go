@@ -0,0 +1,212 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Teams is a filesystem serving several Slack teams at once.  Each
+// team's FSConn lives in teams/$teamId/, with a teams/$domain
+// symlink pointing to it, and all of them share one Super (and so
+// one inode space).  Domains can change, so as with DirSet only the
+// symlink is remade when they do.  /self is a symlink to the
+// default team's self/, which is the first team added.
+type Teams struct {
+	Super *Super
+
+	mu     sync.Mutex
+	dn     *DirNode                // teams/
+	conns  map[string]*FSConn      // by team ID
+	links  map[string]*SymlinkNode // by domain
+	tokens map[string]bool         // of connected teams
+	self   *SymlinkNode
+	opts   *Options      // the latest, for retries
+	done   chan struct{} // closed by Close, to stop retrying
+}
+
+func NewTeams() (*Teams, error) {
+	var err error
+	ts := new(Teams)
+	ts.Super = NewSuper()
+	ts.conns = make(map[string]*FSConn)
+	ts.links = make(map[string]*SymlinkNode)
+	ts.tokens = make(map[string]bool)
+	ts.done = make(chan struct{})
+	ts.dn, err = NewDirNode(ts.Super.root, "teams", ts)
+	if err != nil {
+		return nil, fmt.Errorf("NewDirNode(teams): %s", err)
+	}
+	ts.dn.Activate()
+	return ts, nil
+}
+
+// Add connects to the team the token belongs to.  An error here
+// leaves the teams that are already connected untouched.  If we
+// can't reach Slack, we keep trying in the background, backing off
+// as FSConn does when reconnecting, and the team appears once we
+// get through.
+func (ts *Teams) Add(token string, opts *Options) (*FSConn, error) {
+	ts.mu.Lock()
+	dup := ts.tokens[token]
+	if ts.opts == nil {
+		ts.opts = opts
+	}
+	ts.mu.Unlock()
+	if dup {
+		return nil, fmt.Errorf("token given more than once")
+	}
+
+	conn, err := newFSConn(token, "", opts, ts.Super, ts.dn)
+	if err != nil {
+		go ts.retry(token)
+		return nil, err
+	}
+	if err := ts.insert(token, conn); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// retry connects to the team for token once Slack lets us, or until
+// Close is called.
+func (ts *Teams) retry(token string) {
+	var conn *FSConn
+	ok := retryWithBackoff(ts.done, "Teams.Add", func() error {
+		ts.mu.Lock()
+		opts := ts.opts
+		ts.mu.Unlock()
+
+		var err error
+		conn, err = newFSConn(token, "", opts, ts.Super, ts.dn)
+		return err
+	})
+	if !ok {
+		return
+	}
+	if err := ts.insert(token, conn); err != nil {
+		log.Printf("Teams.Add: %s", err)
+		return
+	}
+	log.Printf("Teams.Add: connected to %s", conn.Domain())
+}
+
+// insert makes a newly connected team visible, recording its token.
+func (ts *Teams) insert(token string, conn *FSConn) error {
+	var err error
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	id := conn.root.Name()
+	if ts.tokens[token] {
+		conn.Close()
+		return fmt.Errorf("token given more than once")
+	}
+	if _, ok := ts.conns[id]; ok {
+		// two tokens for the same team.
+		conn.Close()
+		return fmt.Errorf("team '%s' already added", id)
+	}
+	select {
+	case <-ts.done:
+		// a retry finished after we were closed.
+		conn.Close()
+		return fmt.Errorf("closed")
+	default:
+	}
+	ts.tokens[token] = true
+	ts.conns[id] = conn
+	conn.root.Activate()
+	ts.link(conn, conn.Domain())
+
+	if ts.self == nil {
+		ts.self, err = NewSymlinkNode(ts.Super.root, "self", conn.self.dn)
+		if err != nil {
+			return fmt.Errorf("NewSymlinkNode(self): %s", err)
+		}
+		ts.self.Activate()
+	}
+
+	return nil
+}
+
+// link points teams/$domain at conn's directory.
+//
+// must be called with ts.mu held
+func (ts *Teams) link(conn *FSConn, domain string) {
+	if domain == "" {
+		return
+	}
+	if _, ok := ts.links[domain]; ok {
+		log.Printf("link(%s): domain '%s' already in use", conn.root.Name(), domain)
+		return
+	}
+	s, err := NewSymlinkNode(ts.dn, domain, conn.root)
+	if err != nil {
+		log.Printf("NewSymlinkNode(%s): %s", domain, err)
+		return
+	}
+	ts.links[domain] = s
+	s.Activate()
+}
+
+// Rename points teams/$domain at a team after its domain changes.
+func (ts *Teams) Rename(conn *FSConn, domain string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.conns[conn.root.Name()] != conn {
+		return
+	}
+	if s, ok := ts.links[domain]; ok && s.target == conn.root {
+		return
+	}
+	for old, s := range ts.links {
+		if s.target != conn.root {
+			continue
+		}
+		ts.dn.removeChild(old)
+		delete(ts.links, old)
+	}
+	ts.link(conn, domain)
+}
+
+// Len returns the number of teams connected.
+func (ts *Teams) Len() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return len(ts.conns)
+}
+
+// Close closes every team's connection (see FSConn.Close), and
+// gives up on any we are still trying to connect to.
+func (ts *Teams) Close() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	select {
+	case <-ts.done:
+	default:
+		close(ts.done)
+	}
+	for _, conn := range ts.conns {
+		conn.Close()
+	}
+}
+
+// Reload applies the reloadable options (see FSConn.Reload) to
+// every team.
+func (ts *Teams) Reload(opts *Options) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.opts = opts
+	for _, conn := range ts.conns {
+		conn.Reload(opts)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpowers/slack"
+)
+
+// Timestamp is a Slack message timestamp, like "1430744496.000012":
+// seconds since the Unix epoch, and a 6-digit suffix that makes the
+// timestamp unique within a room.  Timestamps are ordered, and the
+// zero value sorts before every real message.
+type Timestamp struct {
+	Sec int64
+	Seq int64 // the fractional part, in millionths
+}
+
+// ParseTimestamp parses the string form of a Slack timestamp.  Both
+// parts must be plain digits; signs, spaces and exponents are
+// rejected.
+func ParseTimestamp(s string) (Timestamp, error) {
+	var t Timestamp
+	secs, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		secs, frac = s[:i], s[i+1:]
+		if frac == "" {
+			return t, fmt.Errorf("bad timestamp %q", s)
+		}
+	}
+	if secs == "" || !isDigits(secs) || !isDigits(frac) {
+		return t, fmt.Errorf("bad timestamp %q", s)
+	}
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return t, fmt.Errorf("bad timestamp %q", s)
+	}
+	// normalize the fraction to 6 digits, so that "1.5" and
+	// "1.500000" are equal.
+	if len(frac) > 6 {
+		frac = frac[:6]
+	}
+	frac += strings.Repeat("0", 6-len(frac))
+	seq, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return t, fmt.Errorf("bad timestamp %q", s)
+	}
+	t.Sec = sec
+	t.Seq = seq
+	return t, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (t Timestamp) String() string {
+	return fmt.Sprintf("%010d.%06d", t.Sec, t.Seq)
+}
+
+func (t Timestamp) IsZero() bool {
+	return t.Sec == 0 && t.Seq == 0
+}
+
+// Time returns the wall-clock time the timestamp corresponds to.
+func (t Timestamp) Time() time.Time {
+	return time.Unix(t.Sec, t.Seq*1000)
+}
+
+// Compare returns -1, 0 or 1 depending on whether t is before, the
+// same as, or after u.
+func (t Timestamp) Compare(u Timestamp) int {
+	switch {
+	case t.Sec < u.Sec:
+		return -1
+	case t.Sec > u.Sec:
+		return 1
+	case t.Seq < u.Seq:
+		return -1
+	case t.Seq > u.Seq:
+		return 1
+	}
+	return 0
+}
+
+func (t Timestamp) Before(u Timestamp) bool {
+	return t.Compare(u) < 0
+}
+
+func (t Timestamp) After(u Timestamp) bool {
+	return t.Compare(u) > 0
+}
+
+// MarshalJSON encodes t as a string, like the Slack API does.
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON accepts both the string and numeric forms Slack
+// uses for timestamps.
+func (t *Timestamp) UnmarshalJSON(buf []byte) error {
+	var s string
+	if err := json.Unmarshal(buf, &s); err != nil {
+		var n json.Number
+		if err := json.Unmarshal(buf, &n); err != nil {
+			return fmt.Errorf("bad timestamp %s", buf)
+		}
+		s = n.String()
+	}
+	ts, err := ParseTimestamp(s)
+	if err != nil {
+		return err
+	}
+	*t = ts
+	return nil
+}
+
+// parseTimestamps parses n timestamps up front, for sorting.
+// Malformed timestamps are treated as the zero Timestamp, so that
+// they sort before well-formed ones and a bad message from the
+// server can't break sorting.
+func parseTimestamps(n int, ts func(i int) string) []Timestamp {
+	tss := make([]Timestamp, n)
+	for i := range tss {
+		tss[i], _ = ParseTimestamp(ts(i))
+	}
+	return tss
+}
+
+// tsSorter sorts a slice by timestamp.  Timestamps are parsed once,
+// by parseTimestamps, rather than on every comparison.
+type tsSorter struct {
+	ts   []Timestamp
+	swap func(i, j int)
+}
+
+func (p tsSorter) Len() int           { return len(p.ts) }
+func (p tsSorter) Less(i, j int) bool { return p.ts[i].Before(p.ts[j]) }
+func (p tsSorter) Swap(i, j int) {
+	p.ts[i], p.ts[j] = p.ts[j], p.ts[i]
+	p.swap(i, j)
+}
+
+// sortByTs stably sorts the n items of a slice by the timestamps
+// returned by ts.
+func sortByTs(n int, ts func(i int) string, swap func(i, j int)) {
+	sort.Stable(tsSorter{parseTimestamps(n, ts), swap})
+}
+
+// sortMsgs sorts msgs by timestamp, oldest first.
+func sortMsgs(msgs []slack.Message) {
+	sortByTs(len(msgs), func(i int) string {
+		return msgs[i].Timestamp
+	}, func(i, j int) {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	})
+}
+
+type tsSlice []Timestamp
+
+func (p tsSlice) Len() int           { return len(p) }
+func (p tsSlice) Less(i, j int) bool { return p[i].Before(p[j]) }
+func (p tsSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,107 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"testing"
+
+	"github.com/bpowers/slack"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		out Timestamp
+		ok  bool
+	}{
+		{"1430744496.000012", Timestamp{1430744496, 12}, true},
+		{"1430744496", Timestamp{1430744496, 0}, true},
+		{"1.5", Timestamp{1, 500000}, true},
+		{"1.500000", Timestamp{1, 500000}, true},
+		{"1.1234567", Timestamp{1, 123456}, true},
+		{"0000000000.000000", Timestamp{}, true},
+		{"", Timestamp{}, false},
+		{".5", Timestamp{}, false},
+		{"1.", Timestamp{}, false},
+		{"+1.5", Timestamp{}, false},
+		{"-1.5", Timestamp{}, false},
+		{"1.+5", Timestamp{}, false},
+		{"1.-5", Timestamp{}, false},
+		{" 1.5", Timestamp{}, false},
+		{"1e3", Timestamp{}, false},
+		{"1.5.6", Timestamp{}, false},
+		{"abc", Timestamp{}, false},
+		{"99999999999999999999.0", Timestamp{}, false},
+	} {
+		ts, err := ParseTimestamp(tc.in)
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("ParseTimestamp(%q): err = %v, want ok = %v", tc.in, err, tc.ok)
+			continue
+		}
+		if ts != tc.out {
+			t.Errorf("ParseTimestamp(%q) = %#v, want %#v", tc.in, ts, tc.out)
+		}
+	}
+}
+
+func TestTimestampString(t *testing.T) {
+	for _, in := range []string{"1430744496.000012", "0000000001.500000"} {
+		ts, err := ParseTimestamp(in)
+		if err != nil {
+			t.Fatalf("ParseTimestamp(%q): %s", in, err)
+		}
+		if s := ts.String(); s != in {
+			t.Errorf("ParseTimestamp(%q).String() = %q", in, s)
+		}
+	}
+}
+
+func TestTimestampCompare(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		cmp  int
+	}{
+		{"1.000001", "1.000002", -1},
+		{"1.000002", "1.000001", 1},
+		{"1.5", "1.500000", 0},
+		{"1.999999", "2.000000", -1},
+		{"10.0", "9.999999", 1},
+		// a lexical comparison gets this one wrong.
+		{"9.0", "10.0", -1},
+	} {
+		a, err := ParseTimestamp(tc.a)
+		if err != nil {
+			t.Fatalf("ParseTimestamp(%q): %s", tc.a, err)
+		}
+		b, err := ParseTimestamp(tc.b)
+		if err != nil {
+			t.Fatalf("ParseTimestamp(%q): %s", tc.b, err)
+		}
+		if cmp := a.Compare(b); cmp != tc.cmp {
+			t.Errorf("%s.Compare(%s) = %d, want %d", tc.a, tc.b, cmp, tc.cmp)
+		}
+		if a.Before(b) != (tc.cmp < 0) || a.After(b) != (tc.cmp > 0) {
+			t.Errorf("%s.Before/After(%s) disagree with Compare", tc.a, tc.b)
+		}
+	}
+}
+
+func TestSortMsgs(t *testing.T) {
+	var msgs []slack.Message
+	for _, ts := range []string{"10.0", "bad", "9.000002", "9.000001", "1.5"} {
+		var msg slack.Message
+		msg.Timestamp = ts
+		msgs = append(msgs, msg)
+	}
+	sortMsgs(msgs)
+
+	// malformed timestamps sort first.
+	want := []string{"bad", "1.5", "9.000001", "9.000002", "10.0"}
+	for i, msg := range msgs {
+		if msg.Timestamp != want[i] {
+			t.Fatalf("msgs[%d] = %q, want %q", i, msg.Timestamp, want[i])
+		}
+	}
+}
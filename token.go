@@ -0,0 +1,178 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// TokenEnv may hold a Slack API token directly.
+	TokenEnv = "SLACKFS_TOKEN"
+	// TokenPathEnv may name a file holding a Slack API token.
+	TokenPathEnv = "SLACKFS_TOKEN_PATH"
+)
+
+// DefaultTokenPath returns ~/.slack-token.
+func DefaultTokenPath() string {
+	home := ""
+	// If we're statically linked, user.Current won't work.
+	if u, err := user.Current(); err == nil {
+		home = u.HomeDir
+	} else {
+		home = os.Getenv("HOME")
+	}
+	return filepath.Join(home, ".slack-token")
+}
+
+// ReadTokenFile returns the token stored in the file at path.  Files
+// that group or other can read are refused, as the token grants full
+// access to the account.
+func ReadTokenFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("%s is readable by others (mode %s); chmod 600 it", path, fi.Mode().Perm())
+	}
+
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	token := string(bytes.TrimSpace(buf))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return token, nil
+}
+
+// RunTokenCmd returns the output of the shell command cmd, for
+// getting the token from a password manager (e.g. 'pass show
+// slack').  The command's stderr is ours, so that it can prompt.
+func RunTokenCmd(cmd string) (string, error) {
+	c := exec.Command("sh", "-c", cmd)
+	c.Stdin = os.Stdin
+	c.Stderr = os.Stderr
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("'%s': %s", cmd, err)
+	}
+	// only the first line, as 'pass show' puts the password
+	// there and metadata below.
+	token := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	if token == "" {
+		return "", fmt.Errorf("'%s' printed nothing", cmd)
+	}
+	return token, nil
+}
+
+// Tokens returns the configured tokens, one per team.  Token sources
+// given as flags win, followed by $SLACKFS_TOKEN, the file named by
+// $SLACKFS_TOKEN_PATH, the sources in the config file and finally
+// DefaultTokenPath.  Every token-cmd and token-path is tried, and
+// those that fail are returned in errs, so that one bad source
+// doesn't keep the others from being used.
+func (c *Config) Tokens() (tokens []string, errs []error) {
+	cmds, paths := c.TokenCmds, c.TokenPaths
+	if !c.tokensFromFlags {
+		if token := strings.TrimSpace(os.Getenv(TokenEnv)); token != "" {
+			RedactToken(token)
+			return []string{token}, nil
+		}
+		if path := os.Getenv(TokenPathEnv); path != "" {
+			cmds, paths = nil, []string{path}
+		}
+	}
+	if len(cmds) == 0 && len(paths) == 0 {
+		paths = []string{DefaultTokenPath()}
+	}
+
+	for _, cmd := range cmds {
+		token, err := RunTokenCmd(cmd)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("token-cmd: %s", err))
+			continue
+		}
+		RedactToken(token)
+		tokens = append(tokens, token)
+	}
+	for _, path := range paths {
+		token, err := ReadTokenFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("token-path: %s", err))
+			continue
+		}
+		RedactToken(token)
+		tokens = append(tokens, token)
+	}
+	return tokens, errs
+}
+
+var (
+	redactMu     sync.Mutex
+	redactTokens []string
+
+	// catches tokens we weren't told about.
+	tokenRe = regexp.MustCompile(`xox[abprs]-[A-Za-z0-9-]+`)
+)
+
+// RedactToken adds token to the set of strings Redact removes.
+func RedactToken(token string) {
+	if token == "" {
+		return
+	}
+	redactMu.Lock()
+	defer redactMu.Unlock()
+
+	for _, t := range redactTokens {
+		if t == token {
+			return
+		}
+	}
+	redactTokens = append(redactTokens, token)
+}
+
+// Redact replaces anything that looks like a Slack token in s.
+func Redact(s string) string {
+	redactMu.Lock()
+	tokens := redactTokens
+	redactMu.Unlock()
+
+	for _, t := range tokens {
+		s = strings.Replace(s, t, "<redacted>", -1)
+	}
+	return tokenRe.ReplaceAllString(s, "<redacted>")
+}
+
+// RedactWriter passes writes through to W with tokens redacted.
+// Use it with log.SetOutput so that no log line leaks a token.
+type RedactWriter struct {
+	W io.Writer
+}
+
+func (w RedactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.W, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
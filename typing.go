@@ -0,0 +1,148 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bpowers/fuse"
+	"golang.org/x/net/context"
+)
+
+const (
+	// how long after a user_typing event we consider someone
+	// to still be typing.  Clients resend every ~3 seconds.
+	typingTimeout = 5 * time.Second
+
+	// how often we tell Slack we're typing while a write handle
+	// has unsent text.
+	typingInterval = 3 * time.Second
+)
+
+// userTyping records that userId is typing in the room.
+func (s *Session) userTyping(userId string) {
+	s.L.Lock()
+	defer s.L.Unlock()
+
+	s.typing[userId] = time.Now()
+}
+
+// Typers returns the names of users who are currently typing,
+// sorted.
+func (s *Session) Typers() []string {
+	s.L.Lock()
+	defer s.L.Unlock()
+
+	now := time.Now()
+	names := make([]string, 0, len(s.typing))
+	for id, t := range s.typing {
+		if now.Sub(t) > typingTimeout {
+			delete(s.typing, id)
+			continue
+		}
+		if u := s.conn.users.Get(id); u != nil {
+			names = append(names, u.name())
+		} else {
+			names = append(names, id)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Typing tells Slack that we are typing in the room.  Typing
+// indicators are best-effort, so when we're offline or between
+// reconnects this does nothing.
+func (s *Session) Typing() error {
+	ws := s.conn.websocket()
+	if ws == nil {
+		return nil
+	}
+	out := ws.NewTypingMessage(s.id)
+	if err := ws.SendMessage(out); err != nil {
+		log.Printf("SendMessage(typing): %s", err)
+		return err
+	}
+	return nil
+}
+
+// typingState decides when a write handle should tell Slack we are
+// typing.  With write.line, text is only written (and sent) a line
+// at a time, so there is rarely anything buffered; instead we count
+// the writer as typing for typingTimeout after each write.
+type typingState struct {
+	lastWrite time.Time
+	lastSent  time.Time
+}
+
+// wrote records a write to the handle at now.
+func (t *typingState) wrote(now time.Time) {
+	t.lastWrite = now
+}
+
+// due returns true, and records that a typing event was sent, if
+// there has been a write in the last typingTimeout and we haven't
+// sent an event in the last typingInterval.
+func (t *typingState) due(now time.Time) bool {
+	if t.lastWrite.IsZero() || now.Sub(t.lastWrite) > typingTimeout {
+		return false
+	}
+	if !t.lastSent.IsZero() && now.Sub(t.lastSent) < typingInterval {
+		return false
+	}
+	t.lastSent = now
+	return true
+}
+
+type TypingProvider interface {
+	Typers() []string
+}
+
+// typingNode lists the users currently typing in a room, one per
+// line.  Entries expire on their own, so the contents are generated
+// on every read.
+type typingNode struct {
+	AttrNode
+}
+
+func newTyping(parent *DirNode) (INode, error) {
+	name := "typing"
+	n := new(typingNode)
+	if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+		return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+	}
+	n.mode = 0444
+	return n, nil
+}
+
+func (n *typingNode) content() string {
+	names := n.parent.priv.(TypingProvider).Typers()
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.Join(names, "\n") + "\n"
+}
+
+func (n *typingNode) Attr(a *fuse.Attr) {
+	a.Inode = n.ino
+	a.Mode = n.mode
+	a.Size = uint64(len(n.content()))
+}
+
+func (n *typingNode) ReadAll(ctx context.Context) ([]byte, error) {
+	return []byte(n.content()), nil
+}
+
+func (n *typingNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
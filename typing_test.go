@@ -0,0 +1,44 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTypingState(t *testing.T) {
+	start := time.Unix(1430744496, 0)
+	at := func(d time.Duration) time.Time {
+		return start.Add(d)
+	}
+
+	var ts typingState
+	for _, step := range []struct {
+		name  string
+		write bool
+		at    time.Duration
+		due   bool
+	}{
+		{"idle before any write", false, 0, false},
+		{"first write", true, 0, true},
+		{"write within interval", true, time.Second, false},
+		// write.line empties the buffer at every newline,
+		// but we're still typing.
+		{"tick after interval", false, typingInterval + time.Second, true},
+		{"tick within interval", false, typingInterval + 2*time.Second, false},
+		{"write after interval", true, 2*typingInterval + 2*time.Second, true},
+		{"tick past timeout", false, 2*typingInterval + 2*time.Second + typingTimeout + time.Second, false},
+		{"write after idle", true, time.Minute, true},
+	} {
+		now := at(step.at)
+		if step.write {
+			ts.wrote(now)
+		}
+		if due := ts.due(now); due != step.due {
+			t.Fatalf("%s: due(%s) = %t, want %t", step.name, step.at, due, step.due)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// displayLoc is the timezone session timestamps are rendered in.
+func (conn *FSConn) displayLoc() *time.Location {
+	conn.optsMu.Lock()
+	defer conn.optsMu.Unlock()
+
+	if conn.opts.Location != nil {
+		return conn.opts.Location
+	}
+	return time.Local
+}
+
+// Location returns the user's timezone from their Slack profile,
+// falling back to their UTC offset if the zone name isn't one we
+// know, and to nil if they haven't set either.
+func (u *User) Location() *time.Location {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.loc
+}
+
+// userLocation resolves a user's timezone for Location.  Loading a
+// zone reads it from disk, so this is only done when a user's
+// timezone changes.
+func userLocation(tz, label string, offset int) *time.Location {
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err == nil {
+			return loc
+		}
+		log.Printf("LoadLocation(%s): %s", tz, err)
+	}
+	if label != "" || offset != 0 {
+		return time.FixedZone(label, offset)
+	}
+	return nil
+}
+
+// relTime describes t relative to now, like "5m ago".
+func relTime(t, now time.Time) string {
+	d := now.Sub(t)
+	suffix := "ago"
+	if d < 0 {
+		d = -d
+		suffix = "from now"
+	}
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm %s", d/time.Minute, suffix)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %s", d/time.Hour, suffix)
+	}
+	return fmt.Sprintf("%dd %s", d/(24*time.Hour), suffix)
+}
@@ -0,0 +1,35 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelTime(t *testing.T) {
+	now := time.Unix(1430744496, 0)
+	for _, tc := range []struct {
+		d   time.Duration // how long before now
+		out string
+	}{
+		{0, "just now"},
+		{59 * time.Second, "just now"},
+		{-59 * time.Second, "just now"},
+		{time.Minute, "1m ago"},
+		{59*time.Minute + 59*time.Second, "59m ago"},
+		{time.Hour, "1h ago"},
+		{23*time.Hour + 59*time.Minute, "23h ago"},
+		{24 * time.Hour, "1d ago"},
+		{30 * 24 * time.Hour, "30d ago"},
+		{-5 * time.Minute, "5m from now"},
+		{-3 * time.Hour, "3h from now"},
+		{-48 * time.Hour, "2d from now"},
+	} {
+		if out := relTime(now.Add(-tc.d), now); out != tc.out {
+			t.Errorf("relTime(now - %s) = %q, want %q", tc.d, out, tc.out)
+		}
+	}
+}
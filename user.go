@@ -5,26 +5,79 @@
 package slackfs
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"sync"
+	"time"
 
+	"github.com/bpowers/fuse"
 	"github.com/bpowers/slack"
+	"golang.org/x/net/context"
 )
 
+// User is a member of the team.  Other than Id, the fields of the
+// embedded slack.User change on user_change and presence_change
+// events, so they must be read with mu held, or through accessors
+// like name.
 type User struct {
 	slack.User
 	mu   sync.Mutex
 	conn *FSConn
+	loc  *time.Location // from TZ, TZLabel and TZOffset; see Location
 }
 
 func NewUser(su slack.User, conn *FSConn) *User {
 	u := new(User)
 	u.User = su
 	u.conn = conn
+	u.loc = userLocation(su.TZ, su.TZLabel, su.TZOffset)
 
 	return u
 }
 
+func (u *User) name() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.Name
+}
+
+func (u *User) deleted() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.Deleted
+}
+
+// update copies the details from a user_change event into u.  The
+// event doesn't reliably carry presence, which we track through
+// presence_change instead, so Presence is only replaced if set.
+//
+// must be called with u.mu held
+func (u *User) update(su *slack.User) {
+	u.Name = su.Name
+	u.Deleted = su.Deleted
+	u.Color = su.Color
+	u.Profile = su.Profile
+	u.IsBot = su.IsBot
+	u.IsAdmin = su.IsAdmin
+	u.IsOwner = su.IsOwner
+	u.IsPrimaryOwner = su.IsPrimaryOwner
+	u.IsRestricted = su.IsRestricted
+	u.IsUltraRestricted = su.IsUltraRestricted
+	u.HasFiles = su.HasFiles
+	if su.TZ != u.TZ || su.TZLabel != u.TZLabel || su.TZOffset != u.TZOffset {
+		u.loc = userLocation(su.TZ, su.TZLabel, su.TZOffset)
+	}
+	u.TZ = su.TZ
+	u.TZLabel = su.TZLabel
+	u.TZOffset = su.TZOffset
+	if su.Presence != "" {
+		u.Presence = su.Presence
+	}
+}
+
 type userIdNode struct {
 	AttrNode
 }
@@ -61,7 +114,7 @@ func newUserName(parent *DirNode) (INode, error) {
 }
 
 func (n *userNameNode) Update() {
-	val := n.parent.priv.(*User).Name + "\n"
+	val := n.parent.priv.(*User).name() + "\n"
 	n.updateCommon(val)
 }
 
@@ -81,7 +134,10 @@ func newUserPresence(parent *DirNode) (INode, error) {
 }
 
 func (n *userPresenceNode) Update() {
-	val := n.parent.priv.(*User).Presence + "\n"
+	u := n.parent.priv.(*User)
+	u.mu.Lock()
+	val := u.Presence + "\n"
+	u.mu.Unlock()
 	n.updateCommon(val)
 }
 
@@ -101,8 +157,13 @@ func newUserIsBot(parent *DirNode) (INode, error) {
 }
 
 func (n *userIsBotNode) Update() {
+	u := n.parent.priv.(*User)
+	u.mu.Lock()
+	isBot := u.IsBot
+	u.mu.Unlock()
+
 	var val string
-	if n.parent.priv.(*User).IsBot {
+	if isBot {
 		val = "true\n"
 	} else {
 		val = "false\n"
@@ -110,11 +171,131 @@ func (n *userIsBotNode) Update() {
 	n.updateCommon(val)
 }
 
+// userLocaltimeNode shows the user's current wall-clock time, so
+// unlike other attributes its contents are generated on every read.
+type userLocaltimeNode struct {
+	AttrNode
+}
+
+func newUserLocaltime(parent *DirNode) (INode, error) {
+	name := "localtime"
+	n := new(userLocaltimeNode)
+	if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+		return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+	}
+	n.mode = 0444
+	return n, nil
+}
+
+func (n *userLocaltimeNode) now() string {
+	u := n.parent.priv.(*User)
+	loc := u.Location()
+	if loc == nil {
+		loc = u.conn.displayLoc()
+	}
+	return time.Now().In(loc).Format("Mon Jan 02 15:04:05 MST 2006") + "\n"
+}
+
+func (n *userLocaltimeNode) Attr(a *fuse.Attr) {
+	a.Inode = n.ino
+	a.Mode = n.mode
+	a.Size = uint64(len(n.now()))
+}
+
+func (n *userLocaltimeNode) ReadAll(ctx context.Context) ([]byte, error) {
+	return []byte(n.now()), nil
+}
+
+func (n *userLocaltimeNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
+
+type userAttrNode struct {
+	AttrNode
+	val func(u *User) string
+}
+
+// newUserAttr returns a factory for a read-only attribute whose
+// contents are derived from the parent directory's User.  val is
+// called with the User's lock held.
+func newUserAttr(name string, val func(u *User) string) AttrFactory {
+	return func(parent *DirNode) (INode, error) {
+		n := new(userAttrNode)
+		if err := n.AttrNode.Node.Init(parent, name, nil); err != nil {
+			return nil, fmt.Errorf("node.Init('%s': %s", name, err)
+		}
+		n.val = val
+		n.Update()
+		n.mode = 0444
+		return n, nil
+	}
+}
+
+func (n *userAttrNode) Update() {
+	u := n.parent.priv.(*User)
+	u.mu.Lock()
+	val := n.val(u)
+	u.mu.Unlock()
+	n.updateCommon(val)
+}
+
+func (n *userAttrNode) Activate() error {
+	if n.parent == nil {
+		return nil
+	}
+
+	return n.parent.addChild(n)
+}
+
+func userLine(s string) string {
+	return s + "\n"
+}
+
+func userBool(b bool) string {
+	if b {
+		return "true\n"
+	}
+	return "false\n"
+}
+
+func userProfileJSON(u *User) string {
+	buf, err := json.MarshalIndent(&u.User, "", "    ")
+	if err != nil {
+		log.Printf("MarshalIndent(%s): %s", u.Id, err)
+		return ""
+	}
+	return string(buf) + "\n"
+}
+
 var userAttrs = []AttrFactory{
 	newUserId,
 	newUserName,
 	newUserPresence,
 	newUserIsBot,
+	newUserLocaltime,
+	newUserAttr("real-name", func(u *User) string { return userLine(u.Profile.RealName) }),
+	newUserAttr("display-name", func(u *User) string { return userLine(u.Profile.DisplayName) }),
+	newUserAttr("title", func(u *User) string { return userLine(u.Profile.Title) }),
+	newUserAttr("email", func(u *User) string { return userLine(u.Profile.Email) }),
+	newUserAttr("phone", func(u *User) string { return userLine(u.Profile.Phone) }),
+	newUserAttr("tz", func(u *User) string { return userLine(u.TZ) }),
+	newUserAttr("is-admin", func(u *User) string { return userBool(u.IsAdmin) }),
+	newUserAttr("is-owner", func(u *User) string { return userBool(u.IsOwner) }),
+	newUserAttr("is-restricted", func(u *User) string { return userBool(u.IsRestricted) }),
+	newUserAttr("deleted", func(u *User) string { return userBool(u.Deleted) }),
+	newUserAttr("color", func(u *User) string { return userLine(u.Color) }),
+	newUserAttr("profile.json", userProfileJSON),
+	newAvatar("avatar", "192"),
+	newAvatar("avatar-24", "24"),
+	newAvatar("avatar-32", "32"),
+	newAvatar("avatar-48", "48"),
+	newAvatar("avatar-72", "72"),
+	newAvatar("avatar-192", "192"),
+	newAvatar("avatar-original", "original"),
 }
 
 func NewUserDir(parent *DirNode, id string, priv interface{}) (*DirNode, error) {
@@ -0,0 +1,62 @@
+// Copyright 2015 Bobby Powers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slackfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+const apiURL = "https://slack.com/api/"
+
+type apiResponse struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// apiCall invokes a Slack Web API method directly, for the methods
+// github.com/bpowers/slack doesn't wrap.  On success, the response is
+// unmarshaled into out (if non-nil).  Errors reported by Slack are
+// returned verbatim (e.g. "channel_not_found"), so that they can be
+// passed to apiErrno.
+func (conn *FSConn) apiCall(method string, args url.Values, out interface{}) error {
+	if conn.token == "" {
+		return fmt.Errorf("%s: not connected", method)
+	}
+	if args == nil {
+		args = url.Values{}
+	}
+	args.Set("token", conn.token)
+
+	resp, err := http.PostForm(apiURL+method, args)
+	if err != nil {
+		return fmt.Errorf("PostForm(%s): %s", method, err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ReadAll(%s): %s", method, err)
+	}
+
+	var r apiResponse
+	if err = json.Unmarshal(buf, &r); err != nil {
+		return fmt.Errorf("Unmarshal(%s): %s", method, err)
+	}
+	if !r.Ok {
+		return errors.New(r.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	if err = json.Unmarshal(buf, out); err != nil {
+		return fmt.Errorf("Unmarshal(%s): %s", method, err)
+	}
+	return nil
+}